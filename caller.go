@@ -0,0 +1,248 @@
+package purelog
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//caller path styles of Config.SetCallerDepth, besides number of path segments.
+//CallerModule finds package main from build info, without it (e.g. go run main.go)
+//files of package main are written by base name.
+const (
+	CallerFull   = -1  //full path: /home/me/app/internal/db/conn.go
+	CallerModule = -2  //relative to module root: internal/db/conn.go, cmd/app/main.go
+)
+
+//default number of caller path segments: db/conn.go
+const callerDepthDefault = 2
+
+//caller of a pc, resolved once
+type callerInfo struct {
+	file     string  //full path
+	line     int
+	function string  //pkg.(*Type).Method
+	modFile  string  //relative to module root
+}
+
+//pc => caller, call sites are finite so never evicted
+var callers struct {
+	mtx   sync.RWMutex
+	cache map[uintptr]*callerInfo
+}
+
+//main module and dependencies, for module relative paths
+var modules struct {
+	once  sync.Once
+	main  string  //import path of package main
+	paths []string
+}
+
+//caller of skip frames above the function calling callerOf
+func callerOf(skip int) *callerInfo {
+	var pcs [1]uintptr
+	if runtime.Callers(skip + 2, pcs[:]) == 0 {
+		return nil
+	}
+	pc := pcs[0]
+
+	callers.mtx.RLock()
+	info := callers.cache[pc]
+	callers.mtx.RUnlock()
+	if info != nil {
+		return info
+	}
+
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	info = &callerInfo{file: frame.File, line: frame.Line}
+	info.function, info.modFile = splitFunction(frame.Function, frame.File)
+
+	callers.mtx.Lock()
+	if callers.cache == nil {
+		callers.cache = make(map[uintptr]*callerInfo)
+	}
+	callers.cache[pc] = info
+	callers.mtx.Unlock()
+	return info
+}
+
+//file path in style of depth
+func (info *callerInfo) path(depth int) string {
+	switch depth {
+	case CallerFull:
+		return info.file
+	case CallerModule:
+		return info.modFile
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	_, file := reverseSplitN(info.file, depth, '/')
+	return file
+}
+
+//github.com/a/b/internal/db.(*Conn).Close, /src/b/internal/db/conn.go =>
+//db.(*Conn).Close, internal/db/conn.go
+func splitFunction(function, file string) (string, string) {
+	_, base := reverseSplitN(file, 1, '/')
+
+	//type parameters may contain '/'
+	name := function
+	if idx := strings.IndexByte(name, '['); idx != -1 {
+		name = name[:idx]
+	}
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash + 1:], '.')
+	if dot == -1 {
+		return function, base
+	}
+	pkg := function[:slash + 1 + dot]
+	short := function[slash + 1:]
+
+	if pkg == "main" {
+		//main package path from build info
+		if pkg = mainPath(); len(pkg) == 0 || len(modulePath(pkg)) == 0 {
+			return short, base
+		}
+	}
+	mod := modulePath(pkg)
+	switch {
+	case len(mod) == 0:
+		return short, pkg + "/" + base
+	case mod == pkg:
+		return short, base
+	}
+	return short, pkg[len(mod) + 1:] + "/" + base
+}
+
+func loadModules() {
+	modules.once.Do(func() {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		modules.main = info.Path
+		modules.paths = append(modules.paths, info.Main.Path)
+		for _, dep := range info.Deps {
+			modules.paths = append(modules.paths, dep.Path)
+		}
+	})
+}
+
+//import path of package main, empty if unknown
+func mainPath() string {
+	loadModules()
+	return modules.main
+}
+
+//longest module path containing package pkg
+func modulePath(pkg string) string {
+	loadModules()
+
+	mod := ""
+	for _, path := range modules.paths {
+		if len(path) > len(mod) && (pkg == path || strings.HasPrefix(pkg, path + "/")) {
+			mod = path
+		}
+	}
+	return mod
+}
+
+//functions of this package, skipped in stacks
+var selfPrefix = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	slash := strings.LastIndexByte(name, '/')
+	return name[:slash + 1 + strings.IndexByte(name[slash + 1:], '.') + 1]
+}()
+
+//maximum frames of a stack
+const stackDepthMax = 64
+
+//stack of the goroutine from skip frames above the function calling stackOf,
+//without frames of this package:
+//
+//	github.com/a/b/internal/db.(*Conn).Close
+//		/src/b/internal/db/conn.go:42
+//	main.main
+//		/src/b/main.go:10
+func stackOf(skip int) string {
+	var pcs [stackDepthMax]uintptr
+	n := runtime.Callers(skip + 2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if len(frame.Function) != 0 && !isSelfFrame(&frame) {
+			appendFrame(&b, &frame)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+//stack of a panicking goroutine from the panic site, called by the deferred
+//recovering function. returns caller at the panic site and the stack.
+func panicStackOf(skip int) (*callerInfo, string) {
+	var pcs [stackDepthMax]uintptr
+	n := runtime.Callers(skip + 2, pcs[:])
+
+	var frames []runtime.Frame
+	for it := runtime.CallersFrames(pcs[:n]); ; {
+		frame, more := it.Next()
+		frames = append(frames, frame)
+		if !more {
+			break
+		}
+	}
+
+	//panic site is after runtime.gopanic and the runtime frames calling it
+	//for runtime errors (e.g. runtime.sigpanic)
+	for i := range frames {
+		if frames[i].Function == "runtime.gopanic" {
+			frames = frames[i + 1:]
+			for len(frames) > 1 && strings.HasPrefix(frames[0].Function, "runtime.") {
+				frames = frames[1:]
+			}
+			break
+		}
+	}
+
+	var info *callerInfo
+	var b strings.Builder
+	for i := range frames {
+		frame := &frames[i]
+		if len(frame.Function) == 0 || isSelfFrame(frame) {
+			continue
+		}
+		if info == nil {
+			info = &callerInfo{file: frame.File, line: frame.Line}
+			info.function, info.modFile = splitFunction(frame.Function, frame.File)
+		}
+		appendFrame(&b, frame)
+	}
+	return info, b.String()
+}
+
+//function
+//	file:line
+func appendFrame(b *strings.Builder, frame *runtime.Frame) {
+	if b.Len() != 0 {
+		b.WriteByte('\n')
+	}
+	b.WriteString(frame.Function)
+	b.WriteString("\n\t")
+	b.WriteString(frame.File)
+	b.WriteByte(':')
+	b.WriteString(strconv.Itoa(frame.Line))
+}
+
+//frame of this package, except its tests
+func isSelfFrame(frame *runtime.Frame) bool {
+	return strings.HasPrefix(frame.Function, selfPrefix) && !strings.HasSuffix(frame.File, "_test.go")
+}
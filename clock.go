@@ -0,0 +1,48 @@
+package purelog
+
+import (
+	"time"
+)
+
+//time source of a logger: entry timestamps, rotated file names and flush timer.
+//tests set a fake clock to get stable timestamps and trigger flush without sleeping.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+//timer created by Clock, same as time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+//real time, default clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+//atomic.Value requires consistent concrete type, stored by pointer so a
+//changed clock is detected without comparing clocks (may be non-comparable)
+type clockHolder struct {
+	Clock
+}
+
+var systemClockHolder = &clockHolder{SystemClock}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pure-project/purelog"
+	"github.com/pure-project/purelog/parse"
+)
+
+//record filter shared by commands
+type filter struct {
+	level  string
+	since  string
+	until  string
+	pid    int
+	caller string
+	grep   string
+	seek   bool
+
+	minLevel purelog.Level
+	from     time.Time
+	to       time.Time
+	re       *regexp.Regexp
+}
+
+func (f *filter) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.level, "level", "", "minimum level: debug, info, warn or error")
+	fs.StringVar(&f.since, "since", "", "entries at or after time: '2006-01-02 15:04:05', RFC 3339, date, or duration ago (e.g. 1h)")
+	fs.StringVar(&f.until, "until", "", "entries before time, same formats as -since")
+	fs.IntVar(&f.pid, "pid", 0, "entries of process id")
+	fs.StringVar(&f.caller, "caller", "", "entries whose caller file:line contains string")
+	fs.StringVar(&f.grep, "grep", "", "entries whose message matches regexp")
+	fs.BoolVar(&f.seek, "seek", false, "binary search files for -since and stop at -until, only for files written by one process")
+}
+
+//open file for reading, stdin if "-".
+//files are read whole, entries of several processes may be out of time order.
+//with -seek they are binary searched for -since and reading ends at -until.
+func (f *filter) open(name string, rotated bool) (*parse.Reader, error) {
+	switch {
+	case name == "-":
+		return parse.NewReader(os.Stdin), nil
+	case f.seek && rotated:
+		return parse.OpenSetRange(name, f.from, f.to)
+	case f.seek:
+		return parse.OpenRange(name, f.from, f.to)
+	case rotated:
+		return parse.OpenSet(name)
+	}
+	return parse.Open(name)
+}
+
+//validate flags
+func (f *filter) init(now time.Time) error {
+	var err error
+	if len(f.level) != 0 {
+		var ok bool
+		if f.minLevel, ok = parseLevelFlag(f.level); !ok {
+			return fmt.Errorf("bad level %q", f.level)
+		}
+	}
+	if f.from, err = parseTime(f.since, now); err != nil {
+		return err
+	}
+	if f.to, err = parseTime(f.until, now); err != nil {
+		return err
+	}
+	if len(f.grep) != 0 {
+		if f.re, err = regexp.Compile(f.grep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *filter) match(rec *parse.Record) bool {
+	if rec.Level < f.minLevel {
+		return false
+	}
+	if !f.from.IsZero() && rec.Time.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && !rec.Time.Before(f.to) {
+		return false
+	}
+	if f.pid != 0 && rec.Pid != f.pid {
+		return false
+	}
+	if len(f.caller) != 0 && !strings.Contains(fmt.Sprintf("%s:%d", rec.File, rec.Line), f.caller) {
+		return false
+	}
+	if f.re != nil && !f.re.MatchString(rec.Message) {
+		return false
+	}
+	return true
+}
+
+//level name (debug) or short name (DBG)
+func parseLevelFlag(s string) (purelog.Level, bool) {
+	return purelog.LookupLevel(s)
+}
+
+//absolute time in local zone or duration before now
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			d = -d
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{parse.TimeLayout, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad time %q", s)
+}
+
+
+//cat:
+
+func runCat(args []string) error {
+	fs := flag.NewFlagSet("cat", flag.ContinueOnError)
+	var f filter
+	f.register(fs)
+	format := fs.String("o", "text", "output format: text, json or logfmt")
+	rotated := fs.Bool("rotated", false, "also read rotated files of each file, oldest first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.init(time.Now()); err != nil {
+		return err
+	}
+	enc, err := newFormatter(*format)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		r, err := f.open(name, *rotated)
+		if err != nil {
+			return err
+		}
+		err = cat(r, out, &f, enc)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+//filter records from r and write them formatted to w
+func cat(r *parse.Reader, w io.Writer, f *filter, enc formatter) error {
+	var buf []byte
+	for {
+		rec, err := r.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if !f.match(rec) {
+			continue
+		}
+		buf = enc(buf[:0], rec)
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+}
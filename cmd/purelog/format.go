@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pure-project/purelog/parse"
+)
+
+//append formatted record (with newline) to buf
+type formatter func(buf []byte, rec *parse.Record) []byte
+
+func newFormatter(name string) (formatter, error) {
+	switch name {
+	case "text":
+		return formatText, nil
+	case "json":
+		return formatJSON, nil
+	case "logfmt":
+		return formatLogfmt, nil
+	}
+	return nil, fmt.Errorf("bad output format %q", name)
+}
+
+//original text
+func formatText(buf []byte, rec *parse.Record) []byte {
+	buf = append(buf, rec.Raw...)
+	return append(buf, '\n')
+}
+
+//{"time":"...","level":"info","pid":1,"file":"a/b.go","line":1,"msg":"..."}
+func formatJSON(buf []byte, rec *parse.Record) []byte {
+	buf = append(buf, `{"time":"`...)
+	buf = rec.Time.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, `","level":"`...)
+	buf = append(buf, rec.Level.String()...)
+	buf = append(buf, `","pid":`...)
+	buf = strconv.AppendInt(buf, int64(rec.Pid), 10)
+	buf = append(buf, `,"file":`...)
+	buf = appendJSONString(buf, rec.File)
+	buf = append(buf, `,"line":`...)
+	buf = strconv.AppendInt(buf, int64(rec.Line), 10)
+	if len(rec.Func) != 0 {
+		buf = append(buf, `,"func":`...)
+		buf = appendJSONString(buf, rec.Func)
+	}
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSONString(buf, rec.Message)
+	return append(buf, "}\n"...)
+}
+
+//time=... level=info pid=1 caller=a/b.go:1 msg="..."
+func formatLogfmt(buf []byte, rec *parse.Record) []byte {
+	buf = append(buf, "time="...)
+	buf = rec.Time.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, " level="...)
+	buf = append(buf, rec.Level.String()...)
+	buf = append(buf, " pid="...)
+	buf = strconv.AppendInt(buf, int64(rec.Pid), 10)
+	buf = append(buf, " caller="...)
+	buf = appendLogfmtValue(buf, rec.File + ":" + strconv.Itoa(rec.Line))
+	if len(rec.Func) != 0 {
+		buf = append(buf, " func="...)
+		buf = appendLogfmtValue(buf, rec.Func)
+	}
+	buf = append(buf, " msg="...)
+	buf = appendLogfmtValue(buf, rec.Message)
+	return append(buf, '\n')
+}
+
+func appendJSONString(buf []byte, s string) []byte {
+	data, _ := json.Marshal(s)
+	return append(buf, data...)
+}
+
+//quote value containing space, quote, equal sign or control characters
+func appendLogfmtValue(buf []byte, s string) []byte {
+	if len(s) == 0 {
+		return append(buf, `""`...)
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == '"' || c == '=' || c == 0x7f {
+			return strconv.AppendQuote(buf, s)
+		}
+	}
+	return append(buf, s...)
+}
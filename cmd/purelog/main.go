@@ -0,0 +1,60 @@
+//purelog is a tool for reading, filtering and converting purelog files.
+//
+//usage:
+//
+//	purelog <command> [flags] [file...]
+//
+//commands:
+//
+//	cat     filter entries and print them as text, json or logfmt
+//	tail    print last entries and follow the file across rotation
+//	merge   interleave entries of several files by time
+//	stats   count entries by level, caller, pid, minute and message
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"cat", "filter entries and print them as text, json or logfmt", runCat},
+	{"tail", "print last entries and follow the file across rotation", runTail},
+	{"merge", "interleave entries of several files by time", runMerge},
+	{"stats", "count entries by level, caller, pid, minute and message", runStats},
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "purelog %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "purelog: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: purelog <command> [flags] [file...]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun 'purelog <command> -h' for command flags, files default to stdin.\n")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pure-project/purelog"
+	"github.com/pure-project/purelog/parse"
+)
+
+const sample = `garbage before first header
+2022-09-12 23:49:51.542323 16180 demo/main.go:10 DBG | debug message.
+2022-09-12 23:49:51.553323 16180 demo/main.go:11 INF | info message. user=bob
+2022-09-12 23:49:52.000001 16181 demo/worker.go:42 WAR | multi
+line | message
+  with indent
+2022-09-12 23:49:53.100000 16181 demo/main.go:13 ERR | error message.
+`
+
+func TestCat(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		want string
+	} {
+		{[]string{"-level", "warn"}, "WAR | multi\nline | message\n  with indent\n2022-09-12 23:49:53.100000 16181 demo/main.go:13 ERR | error message.\n"},
+		{[]string{"-pid", "16180", "-grep", `user=\w+`}, "2022-09-12 23:49:51.553323 16180 demo/main.go:11 INF | info message. user=bob\n"},
+		{[]string{"-caller", "main.go:13"}, "ERR | error message.\n"},
+		{[]string{"-since", "2022-09-12 23:49:51.553323", "-until", "2022-09-12 23:49:53", "-level", "INF"}, "info message. user=bob\n2022-09-12 23:49:52.000001"},
+		{[]string{"-since", "2022-09-12 23:49:52", "-until", "2022-09-12 23:49:53"}, "WAR | multi\nline | message\n  with indent\n"},
+		{[]string{"-seek", "-since", "2022-09-12 23:49:51.553323", "-until", "2022-09-12 23:49:53", "-level", "INF"}, "info message. user=bob\n2022-09-12 23:49:52.000001"},
+		{[]string{"-level", "error", "-o", "logfmt"}, " level=error pid=16181 caller=demo/main.go:13 msg=\"error message.\"\n"},
+	} {
+		out := runCatArgs(t, c.args)
+		if !strings.Contains(out, c.want) {
+			t.Errorf("cat %v:\n%s\nwant:\n%s", c.args, out, c.want)
+		}
+	}
+
+	//json lines
+	out := runCatArgs(t, []string{"-o", "json"})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected json output:\n%s", out)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[2]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "warn" || entry["msg"] != "multi\nline | message\n  with indent" || entry["line"] != 42.0 {
+		t.Errorf("unexpected json entry: %s", lines[2])
+	}
+}
+
+//written by purelog itself
+func TestCatLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.log")
+
+	logger := purelog.New(purelog.NewConfig().SetFile(file).SetCaller(true))
+	logger.Info("first")
+	logger.Error("second\nline")
+	logger.Close()
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f filter
+	f.level = "error"
+	if err := f.init(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := cat(parse.NewReader(bytes.NewReader(data)), &out, &f, formatLogfmt); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "caller=purelog/main_test.go:") || !strings.HasSuffix(out.String(), ` msg="second\nline"`  + "\n") {
+		t.Errorf("unexpected output: %s", out.String())
+	}
+}
+
+//entries of two processes, 16181 flushed late
+const unordered = `2022-09-12 23:49:51.000000 16180 demo/main.go:10 INF | before
+2022-09-12 23:49:53.500000 16180 demo/main.go:10 INF | after
+2022-09-12 23:49:52.000000 16181 demo/main.go:10 INF | in range
+2022-09-12 23:49:54.000000 16180 demo/main.go:10 INF | last
+`
+
+func TestCatUnordered(t *testing.T) {
+	out := runCatData(t, unordered, []string{"-since", "2022-09-12 23:49:51.5", "-until", "2022-09-12 23:49:53"})
+	if !strings.HasSuffix(out, "INF | in range\n") || strings.Count(out, "\n") != 1 {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func runCatArgs(t *testing.T, args []string) string {
+	return runCatData(t, sample, args)
+}
+
+func runCatData(t *testing.T, content string, args []string) string {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sample.log")
+	if err = ioutil.WriteFile(file, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	//capture stdout
+	stdout := os.Stdout
+	out := filepath.Join(dir, "out")
+	os.Stdout, _ = os.Create(out)
+	err = runCat(append(args, file))
+	os.Stdout.Close()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(out)
+	return string(data)
+}
+
+func TestMerge(t *testing.T) {
+	a := "2022-09-12 23:49:51.000000 1 a.go:1 INF | a1\n2022-09-12 23:49:53.000000 1 a.go:2 INF | a2\n"
+	b := "2022-09-12 23:49:52.000000 2 b.go:1 INF | b1\nline\n2022-09-12 23:49:53.000000 2 b.go:2 ERR | b2\n"
+
+	var readers []*parse.Reader
+	for _, s := range []string{a, b} {
+		readers = append(readers, parse.NewReader(strings.NewReader(s)))
+	}
+	var f filter
+	if err := f.init(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := merge(readers, []string{"a", "b"}, &out, &f, formatText); err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if idx := strings.Index(line, " | "); idx != -1 {
+			msgs = append(msgs, line[idx + 3:])
+		}
+	}
+	if strings.Join(msgs, ",") != "a1,b1,a2,b2" || !strings.Contains(out.String(), "b1\nline\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.log")
+
+	line := func(i int) string {
+		return fmt.Sprintf("2022-09-12 23:49:%02d.000000 1 a.go:1 INF | message %d\n", i, i)
+	}
+	appendFile := func(name, s string) {
+		out, err := os.OpenFile(name, os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.WriteString(s)
+		out.Close()
+	}
+	appendFile(file, line(0) + line(1) + line(2))
+
+	var f filter
+	if err := f.init(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- tail(file, w, &f, formatText, 2, stop)
+		w.Close()
+	}()
+
+	lines := bufio.NewScanner(r)
+	expect := func(i int) {
+		if !lines.Scan() || lines.Text() + "\n" != line(i) {
+			t.Fatalf("want %q got %q", line(i), lines.Text())
+		}
+	}
+	expect(1)
+	expect(2)
+
+	//appended, partial line waits for its newline
+	appendFile(file, line(3) + line(4)[:10])
+	expect(3)
+	appendFile(file, line(4)[10:])
+	expect(4)
+
+	//renamed twice by rotation before the new file is created
+	appendFile(file, line(5))
+	os.Rename(file, filepath.Join(dir, "app_2022-09-12_23-49-05_000000000.log"))
+	appendFile(file, line(6))
+	os.Rename(file, filepath.Join(dir, "app_2022-09-12_23-49-06_000000000.log"))
+	appendFile(file, line(7))
+	expect(5)
+	expect(6)
+	expect(7)
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	data := sample + `2022-09-12 23:51:02.000000 16180 demo/main.go:13 ERR | timeout after 1.5s id=42
+2022-09-12 23:51:03.000000 16180 demo/main.go:13 ERR | timeout after 30s id=7
+stack
+`
+	var f filter
+	if err := f.init(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	s := newStats()
+	if err := s.read(parse.NewReader(strings.NewReader(data)), &f); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s.write(&out, 2)
+
+	for _, want := range []string{
+		"entries: 6 (2022-09-12 23:49:51.542323 - 2022-09-12 23:51:03.000000)\n",
+		"  error         3   50.0%\n",
+		"callers:\n         3   50.0%  demo/main.go:13\n         1   16.7%  demo/main.go:10\n\npids",
+		"         4   66.7%  16180\n         2   33.3%  16181\n",
+		"  2022-09-12 23:49        4 " + strings.Repeat("#", 50) + "\n  2022-09-12 23:50        0 \n  2022-09-12 23:51        2 " + strings.Repeat("#", 25) + "\n",
+		"         2   33.3%  timeout after <n>s id=<n>\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pure-project/purelog/parse"
+)
+
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	var f filter
+	f.register(fs)
+	format := fs.String("o", "text", "output format: text, json or logfmt")
+	rotated := fs.Bool("rotated", false, "read rotated files of each file, oldest first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no files")
+	}
+	if err := f.init(time.Now()); err != nil {
+		return err
+	}
+	enc, err := newFormatter(*format)
+	if err != nil {
+		return err
+	}
+
+	//one source per argument, a rotated set is read as one stream
+	var readers []*parse.Reader
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+	for _, name := range fs.Args() {
+		r, err := f.open(name, *rotated)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, r)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	return merge(readers, fs.Args(), out, &f, enc)
+}
+
+//write records of readers ordered by time, equal times keep reader order
+func merge(readers []*parse.Reader, names []string, w io.Writer, f *filter, enc formatter) error {
+	heads := make([]*parse.Record, len(readers))
+	next := func(i int) error {
+		for {
+			rec, err := readers[i].Read()
+			if err != nil {
+				heads[i] = nil
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return fmt.Errorf("%s: %v", names[i], err)
+			}
+			if f.match(rec) {
+				heads[i] = rec
+				return nil
+			}
+		}
+	}
+	for i := range readers {
+		if err := next(i); err != nil {
+			return err
+		}
+	}
+
+	var buf []byte
+	for {
+		min := -1
+		for i, rec := range heads {
+			if rec != nil && (min == -1 || rec.Time.Before(heads[min].Time)) {
+				min = i
+			}
+		}
+		if min == -1 {
+			return nil
+		}
+
+		buf = enc(buf[:0], heads[min])
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		if err := next(min); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pure-project/purelog"
+	"github.com/pure-project/purelog/parse"
+)
+
+//histogram gaps are filled up to a day of minutes
+const maxHistogramGap = 24 * 60
+
+//widest histogram bar
+const histogramWidth = 50
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	var f filter
+	f.register(fs)
+	rotated := fs.Bool("rotated", false, "also read rotated files of each file, oldest first")
+	top := fs.Int("top", 10, "number of callers and messages shown")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.init(time.Now()); err != nil {
+		return err
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	s := newStats()
+	for _, name := range files {
+		r, err := f.open(name, *rotated)
+		if err != nil {
+			return err
+		}
+		err = s.read(r, &f)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	s.write(out, *top)
+	return nil
+}
+
+//summary of records
+type stats struct {
+	total    int
+	first    time.Time
+	last     time.Time
+	levels   [purelog.LevelOff]int
+	callers  map[string]int
+	pids     map[int]int
+	minutes  map[int64]int  //unix minute
+	messages map[string]int  //normalized first line
+}
+
+func newStats() *stats {
+	return &stats{
+		callers:  make(map[string]int),
+		pids:     make(map[int]int),
+		minutes:  make(map[int64]int),
+		messages: make(map[string]int),
+	}
+}
+
+func (s *stats) read(r *parse.Reader, f *filter) error {
+	for {
+		rec, err := r.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if f.match(rec) {
+			s.add(rec)
+		}
+	}
+}
+
+func (s *stats) add(rec *parse.Record) {
+	s.total++
+	if s.first.IsZero() || rec.Time.Before(s.first) {
+		s.first = rec.Time
+	}
+	if rec.Time.After(s.last) {
+		s.last = rec.Time
+	}
+	if rec.Level < purelog.LevelOff {
+		s.levels[rec.Level]++
+	}
+	s.callers[rec.File + ":" + strconv.Itoa(rec.Line)]++
+	s.pids[rec.Pid]++
+	s.minutes[rec.Time.Unix() / 60]++
+
+	msg := rec.Message
+	if idx := strings.IndexByte(msg, '\n'); idx != -1 {
+		msg = msg[:idx]
+	}
+	s.messages[normalize(msg)]++
+}
+
+func (s *stats) write(w io.Writer, top int) {
+	if s.total == 0 {
+		fmt.Fprintf(w, "no entries\n")
+		return
+	}
+	fmt.Fprintf(w, "entries: %d (%s - %s)\n", s.total, s.first.Format(parse.TimeLayout), s.last.Format(parse.TimeLayout))
+
+	fmt.Fprintf(w, "\nlevels:\n")
+	for level, n := range s.levels {
+		if n != 0 {
+			fmt.Fprintf(w, "  %-6s %8d %6.1f%%\n", purelog.Level(level), n, s.percent(n))
+		}
+	}
+
+	fmt.Fprintf(w, "\ncallers:\n")
+	for _, c := range topCounts(s.callers, top) {
+		fmt.Fprintf(w, "  %8d %6.1f%%  %s\n", c.n, s.percent(c.n), c.key)
+	}
+
+	fmt.Fprintf(w, "\npids:\n")
+	pids := make(map[string]int, len(s.pids))
+	for pid, n := range s.pids {
+		pids[strconv.Itoa(pid)] = n
+	}
+	for _, c := range topCounts(pids, 0) {
+		fmt.Fprintf(w, "  %8d %6.1f%%  %s\n", c.n, s.percent(c.n), c.key)
+	}
+
+	fmt.Fprintf(w, "\nper minute:\n")
+	s.writeHistogram(w)
+
+	fmt.Fprintf(w, "\nmessages:\n")
+	for _, c := range topCounts(s.messages, top) {
+		fmt.Fprintf(w, "  %8d %6.1f%%  %s\n", c.n, s.percent(c.n), c.key)
+	}
+}
+
+func (s *stats) writeHistogram(w io.Writer) {
+	minutes := make([]int64, 0, len(s.minutes))
+	max := 0
+	for m, n := range s.minutes {
+		minutes = append(minutes, m)
+		if n > max {
+			max = n
+		}
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i] < minutes[j] })
+
+	//fill empty minutes of short ranges so gaps show
+	if span := minutes[len(minutes) - 1] - minutes[0]; span < maxHistogramGap {
+		minutes = minutes[:0]
+		for m := s.first.Unix() / 60; m <= s.last.Unix() / 60; m++ {
+			minutes = append(minutes, m)
+		}
+	}
+
+	for _, m := range minutes {
+		n := s.minutes[m]
+		bar := (n * histogramWidth + max - 1) / max
+		fmt.Fprintf(w, "  %s %8d %s\n", time.Unix(m * 60, 0).Format("2006-01-02 15:04"), n, strings.Repeat("#", bar))
+	}
+}
+
+func (s *stats) percent(n int) float64 {
+	return float64(n) * 100 / float64(s.total)
+}
+
+type count struct {
+	key string
+	n   int
+}
+
+//counts sorted by n descending then key, at most top if top > 0
+func topCounts(m map[string]int, top int) []count {
+	counts := make([]count, 0, len(m))
+	for key, n := range m {
+		counts = append(counts, count{key, n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].n != counts[j].n {
+			return counts[i].n > counts[j].n
+		}
+		return counts[i].key < counts[j].key
+	})
+	if top > 0 && len(counts) > top {
+		counts = counts[:top]
+	}
+	return counts
+}
+
+//replace numbers with <n> so messages differing only by ids, sizes or
+//durations count together: "took 1.5ms for id 42" => "took <n>ms for id <n>"
+func normalize(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); {
+		if !isDigit(msg[i]) {
+			b.WriteByte(msg[i])
+			i++
+			continue
+		}
+		for i < len(msg) && (isDigit(msg[i]) || msg[i] == '.' && i + 1 < len(msg) && isDigit(msg[i + 1])) {
+			i++
+		}
+		b.WriteString("<n>")
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pure-project/purelog/parse"
+)
+
+//poll interval of follow mode
+const followPoll = 200 * time.Millisecond
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	var f filter
+	f.register(fs)
+	format := fs.String("o", "text", "output format: text, json or logfmt")
+	n := fs.Int("n", 10, "print last n matching entries before following")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("need exactly one file")
+	}
+	if err := f.init(time.Now()); err != nil {
+		return err
+	}
+	enc, err := newFormatter(*format)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		close(stop)
+	}()
+
+	return tail(fs.Arg(0), os.Stdout, &f, enc, *n, stop)
+}
+
+//print last n matching entries of file then follow it until stop is closed
+func tail(name string, w io.Writer, f *filter, enc formatter, n int, stop <-chan struct{}) error {
+	fl := &follower{name: name}
+	defer fl.close()
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	//last n entries of current content
+	var last []*parse.Record
+	rd := parse.NewReader(fl)
+	for {
+		rec, err := rd.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if n > 0 && f.match(rec) {
+			if len(last) == n {
+				last = append(last[:0], last[1:]...)
+			}
+			last = append(last, rec)
+		}
+	}
+
+	var buf []byte
+	for _, rec := range last {
+		buf = enc(buf[:0], rec)
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	//follow
+	for {
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(followPoll):
+		}
+
+		for {
+			rec, err := rd.Read()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return err
+			}
+			if !f.match(rec) {
+				continue
+			}
+			buf = enc(buf[:0], rec)
+			if _, err = out.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+
+//follower:
+
+//reads a file like tail -F: when the file is renamed by rotation the rest of
+//it and any later rotated files are read before switching to the new file.
+//only complete lines are returned, io.EOF means no more data for now.
+type follower struct {
+	name    string
+	file    *os.File
+	pending []string  //rotated files to read before reopening name
+	buf     []byte
+	off     int
+}
+
+func (fl *follower) Read(p []byte) (int, error) {
+	for {
+		if idx := bytes.LastIndexByte(fl.buf[fl.off:], '\n'); idx != -1 {
+			n := copy(p, fl.buf[fl.off : fl.off + idx + 1])
+			fl.off += n
+			return n, nil
+		}
+		if ok, err := fl.fill(); !ok {
+			return 0, err
+		}
+	}
+}
+
+//read more data, false if none for now
+func (fl *follower) fill() (bool, error) {
+	if fl.file == nil && !fl.open() {
+		return false, io.EOF
+	}
+
+	//compact
+	if fl.off != 0 {
+		fl.buf = append(fl.buf[:0], fl.buf[fl.off:]...)
+		fl.off = 0
+	}
+
+	var chunk [32 * 1024]byte
+	n, err := fl.file.Read(chunk[:])
+	if n > 0 {
+		fl.buf = append(fl.buf, chunk[:n]...)
+		return true, nil
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	//at end, continue with next file if rotated
+	if !fl.rotated() {
+		return false, io.EOF
+	}
+	//data written just before the rename
+	if n, _ = fl.file.Read(chunk[:]); n > 0 {
+		fl.buf = append(fl.buf, chunk[:n]...)
+		return true, nil
+	}
+	fl.file.Close()
+	fl.file = nil
+	return true, nil
+}
+
+//open next pending rotated file or the active file
+func (fl *follower) open() bool {
+	for len(fl.pending) != 0 {
+		name := fl.pending[0]
+		fl.pending = fl.pending[1:]
+		if file, err := os.Open(name); err == nil {
+			fl.file = file
+			return true
+		}
+	}
+
+	file, err := os.Open(fl.name)
+	if err != nil {
+		return false
+	}
+	fl.file = file
+	return true
+}
+
+//whether the open file was renamed or truncated, sets pending rotated files
+func (fl *follower) rotated() bool {
+	cur, err := fl.file.Stat()
+	if err != nil {
+		return true
+	}
+	active, statErr := os.Stat(fl.name)
+	if statErr == nil && os.SameFile(cur, active) {
+		if off, err := fl.file.Seek(0, io.SeekCurrent); err == nil && active.Size() < off {
+			fl.file.Seek(0, io.SeekStart)  //truncated
+		}
+		return false
+	}
+
+	//renamed, files rotated after the open one
+	fl.pending = fl.pending[:0]
+	set, _ := parse.FileSet(fl.name)
+	for i := range set {
+		if set[i].Rotated.IsZero() {
+			break
+		}
+		if info, err := os.Stat(set[i].Name); err == nil && os.SameFile(cur, info) {
+			for _, file := range set[i + 1:] {
+				if !file.Rotated.IsZero() {
+					fl.pending = append(fl.pending, file.Name)
+				}
+			}
+			break
+		}
+	}
+
+	//wait for the new file to be created
+	return len(fl.pending) != 0 || statErr == nil
+}
+
+func (fl *follower) close() {
+	if fl.file != nil {
+		fl.file.Close()
+	}
+}
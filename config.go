@@ -1,24 +1,45 @@
 package purelog
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type Config struct {
-	file   atomic.Value
-	size   uint64
-	flush  uint64
-	level  uint32
-	stderr uint32
-	stdout uint32
-	count  uint32
-	caller uint32
+	file      atomic.Value
+	extractor atomic.Value
+	clock     atomic.Value
+	zone      atomic.Value
+	layout    atomic.Value
+	name      atomic.Value
+	sinks     atomic.Value
+	smtx      sync.Mutex
+	size      uint64
+	maxMsg    uint64
+	flush     uint64
+	level     uint32
+	errLevel  uint32  //level + 1, 0: LevelOff for zero Config
+	stkLevel  uint32  //level + 1, 0: LevelOff for zero Config
+	stderr    uint32
+	stdout    uint32
+	count     uint32
+	caller    uint32
+	callerFn  uint32
+	panicCont uint32
+	depth     int32  //0: callerDepthDefault
+	timeFmt   uint32
+	color     uint32
+	escape    uint32
 }
 
 func NewConfig() *Config {
 	c := &Config{}
 	c.file.Store("")
+	c.clock.Store(systemClockHolder)
+	c.zone.Store((*time.Location)(nil))
+	c.layout.Store((*layout)(nil))
+	c.name.Store("")
 	return c
 }
 
@@ -42,11 +63,30 @@ func (c *Config) SetLevel(level Level) *Config {
 	return c
 }
 
+//route stdout entries at or above level to stderr (LevelOff: disabled, default)
+func (c *Config) SetStderrLevel(level Level) *Config {
+	atomic.StoreUint32(&c.errLevel, levelPlus1(level))
+	return c
+}
+
+//attach stack trace to entries at or above level (LevelOff: disabled, default)
+func (c *Config) SetStacktraceLevel(level Level) *Config {
+	atomic.StoreUint32(&c.stkLevel, levelPlus1(level))
+	return c
+}
+
 func (c *Config) SetSize(size uint) *Config {
 	atomic.StoreUint64(&c.size, uint64(size))
 	return c
 }
 
+//truncate longer messages with a "...[truncated N bytes]" marker (0: unlimited, default).
+//keep it below file size so rotation never cuts an entry.
+func (c *Config) SetMaxMessageSize(size uint) *Config {
+	atomic.StoreUint64(&c.maxMsg, uint64(size))
+	return c
+}
+
 func (c *Config) SetCount(count uint) *Config {
 	atomic.StoreUint32(&c.count, uint32(count))
 	return c
@@ -57,11 +97,112 @@ func (c *Config) SetCaller(enb bool) *Config {
 	return c
 }
 
+//set timestamp format of stdout/file output, TimeDefault by default.
+//json always uses RFC 3339 with microseconds, see NewJSONEncoder.
+func (c *Config) SetTimeFormat(format TimeFormat) *Config {
+	atomic.StoreUint32(&c.timeFmt, uint32(format))
+	return c
+}
+
+//color stdout output (ColorAuto: when stdout is a terminal, default), file output is always plain
+func (c *Config) SetColor(mode ColorMode) *Config {
+	atomic.StoreUint32(&c.color, uint32(mode))
+	return c
+}
+
+//escape newlines and control characters of messages in stdout/file output, so
+//user input can't forge entries (EscapeOff: default). field values are always quoted.
+//sinks: see EscapeEncoder.
+func (c *Config) SetEscape(mode Escape) *Config {
+	atomic.StoreUint32(&c.escape, uint32(mode))
+	return c
+}
+
+//set time zone of stdout/file output timestamps (e.g. time.UTC), nil for local
+func (c *Config) SetTimeZone(loc *time.Location) *Config {
+	c.zone.Store(loc)
+	return c
+}
+
+//set text layout of stdout/file output, e.g. "{time} {level} [{name}] {caller} {msg}",
+//empty for DefaultLayout. placeholders:
+//
+//	{time}    timestamp in configured format and zone
+//	{pid}     process id
+//	{caller}  file:line, followed by function if SetCallerFunc
+//	{file}    caller file
+//	{line}    caller line
+//	{func}    caller function if SetCallerFunc
+//	{level}   DBG, INF, WAR or ERR
+//	{name}    logger name set by SetName
+//	{host}    hostname
+//	{msg}     message, followed by fields unless {fields} is used
+//	{fields}  key=value fields
+//
+//unknown placeholders are written as is.
+func (c *Config) SetLayout(template string) *Config {
+	if len(template) == 0 || template == DefaultLayout {
+		c.layout.Store((*layout)(nil))
+	} else {
+		c.layout.Store(compileLayout(template))
+	}
+	return c
+}
+
+//set logger name written by {name} in layout
+func (c *Config) SetName(name string) *Config {
+	c.name.Store(name)
+	return c
+}
+
+//set caller path segments written (1: basename, 0: default 2), or CallerFull, CallerModule
+func (c *Config) SetCallerDepth(depth int) *Config {
+	atomic.StoreInt32(&c.depth, int32(depth))
+	return c
+}
+
+//also write caller function name, e.g. db.(*Conn).Close
+func (c *Config) SetCallerFunc(enb bool) *Config {
+	atomic.StoreUint32(&c.callerFn, bool2uint32(enb))
+	return c
+}
+
+//continue after RecoverAndLog logged a panic instead of re-panicking (default)
+func (c *Config) SetPanicContinue(enb bool) *Config {
+	atomic.StoreUint32(&c.panicCont, bool2uint32(enb))
+	return c
+}
+
 func (c *Config) SetFlush(flush time.Duration) *Config {
 	atomic.StoreUint64(&c.flush, uint64(flush))
 	return c
 }
 
+//set extractor used by context-aware logging to pull extra fields (e.g. trace ids) from context
+func (c *Config) SetContextExtractor(extractor ContextExtractor) *Config {
+	c.extractor.Store(extractor)
+	return c
+}
+
+//set time source, SystemClock by default
+func (c *Config) SetClock(clock Clock) *Config {
+	c.clock.Store(&clockHolder{clock})
+	return c
+}
+
+//add output sink, entries reaching sink's level are written to it besides stdout/file
+func (c *Config) AddSink(sink Sink) *Config {
+	c.smtx.Lock()
+	defer c.smtx.Unlock()
+
+	//copy on write, logging goroutines read sinks without lock
+	sinks := c.getSinks()
+	newSinks := make([]Sink, 0, len(sinks) + 1)
+	newSinks = append(newSinks, sinks...)
+	c.sinks.Store(append(newSinks, sink))
+	return c
+}
+
 
 
 func (c *Config) getFile() string {
@@ -73,6 +214,29 @@ func (c *Config) getFile() string {
 	return ""
 }
 
+func (c *Config) getContextExtractor() ContextExtractor {
+	extractor, _ := c.extractor.Load().(ContextExtractor)
+	return extractor
+}
+
+func (c *Config) getClock() Clock {
+	return c.getClockHolder().Clock
+}
+
+//holder of clock, a new one on each SetClock
+func (c *Config) getClockHolder() *clockHolder {
+	holder, _ := c.clock.Load().(*clockHolder)
+	if holder == nil {
+		return systemClockHolder
+	}
+	return holder
+}
+
+func (c *Config) getSinks() []Sink {
+	sinks, _ := c.sinks.Load().([]Sink)
+	return sinks
+}
+
 func (c *Config) getStderr() bool {
 	return atomic.LoadUint32(&c.stderr) != 0
 }
@@ -85,10 +249,22 @@ func (c *Config) getLevel() Level {
 	return Level(atomic.LoadUint32(&c.level))
 }
 
+func (c *Config) getStderrLevel() Level {
+	return levelMinus1(atomic.LoadUint32(&c.errLevel))
+}
+
+func (c *Config) getStacktraceLevel() Level {
+	return levelMinus1(atomic.LoadUint32(&c.stkLevel))
+}
+
 func (c *Config) getSize() uint64 {
 	return atomic.LoadUint64(&c.size)
 }
 
+func (c *Config) getMaxMessageSize() uint64 {
+	return atomic.LoadUint64(&c.maxMsg)
+}
+
 func (c *Config) getCount() uint32 {
 	return atomic.LoadUint32(&c.count)
 }
@@ -97,6 +273,48 @@ func (c *Config) getCaller() bool {
 	return atomic.LoadUint32(&c.caller) != 0
 }
 
+func (c *Config) getTimeFormat() TimeFormat {
+	return TimeFormat(atomic.LoadUint32(&c.timeFmt))
+}
+
+func (c *Config) getColor() ColorMode {
+	return ColorMode(atomic.LoadUint32(&c.color))
+}
+
+func (c *Config) getEscape() Escape {
+	return Escape(atomic.LoadUint32(&c.escape))
+}
+
+func (c *Config) getTimeZone() *time.Location {
+	loc, _ := c.zone.Load().(*time.Location)
+	return loc
+}
+
+func (c *Config) getLayout() *layout {
+	l, _ := c.layout.Load().(*layout)
+	return l
+}
+
+func (c *Config) getName() string {
+	name, _ := c.name.Load().(string)
+	return name
+}
+
+func (c *Config) getCallerDepth() int {
+	if depth := atomic.LoadInt32(&c.depth); depth != 0 {
+		return int(depth)
+	}
+	return callerDepthDefault
+}
+
+func (c *Config) getCallerFunc() bool {
+	return atomic.LoadUint32(&c.callerFn) != 0
+}
+
+func (c *Config) getPanicContinue() bool {
+	return atomic.LoadUint32(&c.panicCont) != 0
+}
+
 func (c *Config) getFlush() time.Duration {
 	return time.Duration(atomic.LoadUint64(&c.flush))
 }
@@ -107,3 +325,17 @@ func bool2uint32(b bool) uint32 {
 	return 0
 }
 
+//store level so that zero means LevelOff
+func levelPlus1(level Level) uint32 {
+	if level >= LevelOff {
+		return 0
+	}
+	return uint32(level) + 1
+}
+
+func levelMinus1(v uint32) Level {
+	if v == 0 {
+		return LevelOff
+	}
+	return Level(v - 1)
+}
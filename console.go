@@ -0,0 +1,120 @@
+package purelog
+
+import (
+	"os"
+	"time"
+)
+
+//color of stdout output, see Config.SetColor
+type ColorMode uint32
+const (
+	ColorAuto   ColorMode = iota  //color when stdout is a terminal (default)
+	ColorAlways
+	ColorNever
+)
+
+//ansi escapes
+const (
+	ansiReset = "\x1b[0m"
+	ansiDim   = "\x1b[2m"
+)
+
+//callers shorter than this are padded so messages line up
+const consoleCallerWidth = 24
+
+//colored text encoder for terminals:
+//
+//	2022-09-12 23:49:51.553323 INF demo/main.go:20           handle order request_id=7f3a2c
+//
+//level is colored, time and caller are dimmed. with Config.SetLayout, stdout
+//output follows the layout and colors its {time}, {level} and {caller}.
+func NewConsoleEncoder(format TimeFormat, loc *time.Location) Encoder {
+	return consoleEncoder{format: format, loc: loc}
+}
+
+type consoleEncoder struct {
+	format TimeFormat
+	loc    *time.Location
+	layout *layout  //nil: format above
+	name   string
+	escape Escape  //of message
+}
+
+func (enc consoleEncoder) Encode(buf []byte, e *Entry) []byte {
+	if enc.layout != nil {
+		text := textEncoder{format: enc.format, loc: enc.loc, layout: enc.layout, name: enc.name, escape: enc.escape, color: true}
+		return text.Encode(buf, e)
+	}
+
+	t := e.Time
+	if enc.loc != nil {
+		t = t.In(enc.loc)
+	}
+	buf = append(buf, ansiDim...)
+	buf = appendTime(buf, t, enc.format)
+	buf = append(buf, ansiReset...)
+	buf = append(buf, ' ')
+
+	buf = append(buf, levelColor(e.Level)...)
+	buf = append(buf, e.Level.shortString()...)
+	buf = append(buf, ansiReset...)
+	buf = append(buf, ' ')
+
+	buf = append(buf, ansiDim...)
+	beg := len(buf)
+	buf = append(buf, e.File...)
+	buf = append(buf, ':')
+	buf = appendInt(buf, e.Line)
+	if len(e.Function) != 0 {
+		buf = append(buf, ' ')
+		buf = append(buf, e.Function...)
+	}
+	width := len(buf) - beg
+	buf = append(buf, ansiReset...)
+	for ; width < consoleCallerWidth; width++ {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, ' ')
+
+	buf = appendEscaped(buf, e.Message, enc.escape)
+	buf = appendFields(buf, e.Fields)
+	return appendStack(buf, e.Stack)
+}
+
+//start color code if coloring
+func (enc *textEncoder) colorOn(buf []byte, code string) []byte {
+	if enc.color {
+		buf = append(buf, code...)
+	}
+	return buf
+}
+
+//reset color if coloring
+func (enc *textEncoder) colorOff(buf []byte) []byte {
+	if enc.color {
+		buf = append(buf, ansiReset...)
+	}
+	return buf
+}
+
+func levelColor(level Level) string {
+	switch level {
+	case LevelInfo:
+		return "\x1b[32m"  //green
+	case LevelWarn:
+		return "\x1b[33m"  //yellow
+	case LevelError:
+		return "\x1b[1;31m"  //bold red
+	default:
+		return "\x1b[36m"  //cyan
+	}
+}
+
+//stdout is a terminal accepting colors, honoring NO_COLOR and TERM=dumb
+func colorTerminal() bool {
+	if len(os.Getenv("NO_COLOR")) != 0 || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode() & os.ModeCharDevice != 0
+}
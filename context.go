@@ -0,0 +1,97 @@
+package purelog
+
+import (
+	"context"
+	"strings"
+)
+
+type fieldsKey struct{}
+
+//returns a copy of ctx carrying fields (after the fields already bound to ctx)
+func NewContext(ctx context.Context, fields ...Field) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	bound := FromContext(ctx)
+	merged := make([]Field, 0, len(bound) + len(fields))
+	merged = append(merged, bound...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+//returns fields bound to ctx
+func FromContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]Field)
+	return fields
+}
+
+//pull extra fields from context, lets purelog work with any tracing library
+type ContextExtractor func(ctx context.Context) []Field
+
+
+//w3c trace context:
+
+type traceparentKey struct{}
+
+//returns a copy of ctx carrying w3c traceparent header value
+//
+//00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, traceparentKey{}, traceparent)
+}
+
+//built-in extractor: trace_id and span_id from traceparent bound by WithTraceparent
+func TraceparentExtractor(ctx context.Context) []Field {
+	traceparent, _ := ctx.Value(traceparentKey{}).(string)
+	traceID, spanID, ok := parseTraceparent(traceparent)
+	if !ok {
+		return nil
+	}
+	return []Field{
+		{Key: "trace_id", Value: traceID},
+		{Key: "span_id",  Value: spanID},
+	}
+}
+
+//version-traceid-parentid-flags
+func parseTraceparent(s string) (string, string, bool) {
+	//00-(32)-(16)-(2)
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return "", "", false
+	}
+	//version ff is invalid, version 00 must be exact length
+	if !isHex(s[:2]) || s[:2] == "ff" || (s[:2] == "00" && len(s) != 55) {
+		return "", "", false
+	}
+	//future versions may append more fields
+	if len(s) > 55 && s[55] != '-' {
+		return "", "", false
+	}
+	traceID, spanID := s[3:35], s[36:52]
+	if !isHex(traceID) || !isHex(spanID) || !isHex(s[53:55]) {
+		return "", "", false
+	}
+	//all zero ids are invalid
+	if strings.Count(traceID, "0") == len(traceID) || strings.Count(spanID, "0") == len(spanID) {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+//lowercase hex only
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	stdctx "context"
 	"github.com/pure-project/purelog"
+	"net/http"
+	"os"
 	"time"
 )
 
@@ -51,6 +54,9 @@ func recommend() {
 	//set custom logger's level
 	config.SetLevel(purelog.LevelWarn)
 
+	//send error entries to stderr, others to stdout
+	config.SetStderrLevel(purelog.LevelError)
+
 	//flush log data
 	purelog.Flush()
 }
@@ -78,4 +84,141 @@ func rotate() {
 	config.SetFile("test2.log")
 
 	logger.Info("enjoy yourself!")
-}
\ No newline at end of file
+}
+
+func context() {
+	//bind request-scoped fields once (e.g. in http middleware)
+	ctx := purelog.NewContext(stdctx.Background(),
+		purelog.F("request_id", "7f3a2c"),
+		purelog.F("user_id", 1001))
+
+	//more fields can be bound down the call chain
+	ctx = purelog.NewContext(ctx, purelog.F("tenant", "acme"))
+
+	//outputs: ... INF | handle order request_id=7f3a2c user_id=1001 tenant=acme
+	purelog.InfoCtx(ctx, "handle order")
+	purelog.WarnfCtx(ctx, "slow query: %v", 2 * time.Second)
+
+	//pull trace ids into every context-aware entry
+	purelog.DefaultConfig.SetContextExtractor(purelog.TraceparentExtractor)
+	ctx = purelog.WithTraceparent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	//outputs: ... INF | traced ... trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7
+	purelog.InfoCtx(ctx, "traced")
+}
+
+func sinks() {
+	config := purelog.NewConfig().
+		SetLevel(purelog.LevelError).     //main output (stdout/file) level
+		SetFile("error.log").
+		AddSink(purelog.NewFileSink("debug.log").     //debug+ text to file with own rotation
+			SetSize(100 * 1024 * 1024).
+			SetCount(5)).
+		AddSink(purelog.NewWriterSink(os.Stderr).     //warn+ json to stderr
+			SetLevel(purelog.LevelWarn).
+			SetEncoder(purelog.JSONEncoder))
+
+	//all sinks are flushed by the logger's flush goroutine
+	logger := purelog.New(config)
+	defer logger.Close()
+
+	logger.Debug("only in debug.log")
+	logger.Warn("in debug.log and stderr")
+	logger.Error("everywhere")
+}
+
+func syslog() {
+	config := purelog.NewConfig().
+		AddSink(purelog.NewSyslogSink("", "").  //local syslog (/dev/log)
+			SetLevel(purelog.LevelInfo).
+			SetFacility(purelog.FacilityLocal0)).
+		AddSink(purelog.NewSyslogSink("tcp", "10.0.0.1:514").  //remote syslog with octet-counting framing
+			SetLevel(purelog.LevelWarn).
+			SetFormat(purelog.SyslogRFC3164))
+
+	logger := purelog.New(config)
+	defer logger.Close()
+
+	logger.Warn("to local and remote syslog")
+}
+
+func network() {
+	config := purelog.NewConfig().
+		SetFile("app.log").
+		AddSink(purelog.NewNetworkSink("tcp", "collector:5170").   //newline-delimited json over tcp
+			SetEncoder(purelog.JSONEncoder).
+			SetSpill("/var/spool/app.spill", 16 * 1024 * 1024))    //keep up to 16MB on disk while collector is down (default: app.log.spill, 64MB)
+
+	logger := purelog.New(config)
+	defer logger.Close()
+
+	logger.Info("to file and collector")
+}
+
+func httpBatch() {
+	config := purelog.NewConfig().
+		AddSink(purelog.NewHTTPSink("http://127.0.0.1:8080/ingest").  //ndjson batches on each flush
+			SetGzip(true).
+			SetBatchSize(512 * 1024).
+			SetHeader("Authorization", "Bearer token"))
+
+	logger := purelog.New(config)
+	defer logger.Close()
+
+	logger.Info("to log collector")
+}
+
+func ring() {
+	//keep the last 1000 debug entries in memory, whatever the main output level is
+	ring := purelog.NewRingSink(1000).SetSize(1024 * 1024)
+	config := purelog.NewConfig().
+		SetLevel(purelog.LevelWarn).
+		SetFile("app.log").
+		AddSink(ring)
+
+	logger := purelog.New(config)
+	defer logger.Close()
+
+	//admin endpoint shows recent logs
+	http.Handle("/debug/logs", ring)
+
+	logger.Debug("recorded in ring only")
+	if err := doWork(); err != nil {
+		logger.Error("work failed: ", err)
+		ring.WriteTo(os.Stderr)   //dump recent debug context
+	}
+}
+
+func tail() {
+	tail := purelog.NewTailSink()
+	config := purelog.NewConfig().
+		SetFile("app.log").
+		AddSink(tail)
+
+	logger := purelog.New(config)
+	defer logger.Close()
+
+	//live tail with server-sent events:
+	//curl -N 'http://127.0.0.1:6060/debug/tail?level=warn&q=timeout'
+	http.Handle("/debug/tail", tail)
+	go http.ListenAndServe("127.0.0.1:6060", nil)
+
+	logger.Warn("upstream timeout")
+}
+
+func doWork() error {
+	return nil
+}
+
+func main() {
+	simple()
+	recommend()
+	rotate()
+	context()
+	sinks()
+	syslog()
+	network()
+	httpBatch()
+	ring()
+	tail()
+}
@@ -0,0 +1,225 @@
+package purelog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+//encode entry to bytes
+type Encoder interface {
+	//append encoded entry (with line ending) to buf
+	Encode(buf []byte, e *Entry) []byte
+}
+
+var (
+	//1949-10-01 07:00:00.000000 pid file:line level | message key=value\n
+	TextEncoder Encoder = textEncoder{}
+
+	//{"time":"1949-10-01T07:00:00.000000+08:00","level":"info","pid":1,"caller":"file:line","msg":"message","key":"value"}\n
+	JSONEncoder Encoder = jsonEncoder{}
+)
+
+
+//text:
+
+//text encoder with timestamp format, in zone loc (nil: local)
+func NewTextEncoder(format TimeFormat, loc *time.Location) Encoder {
+	return textEncoder{format: format, loc: loc}
+}
+
+type textEncoder struct {
+	format TimeFormat
+	loc    *time.Location
+	layout *layout  //nil: DefaultLayout
+	name   string
+	escape Escape  //of message
+	color  bool    //color time, level and caller of layout, see consoleEncoder
+}
+
+func (enc textEncoder) Encode(buf []byte, e *Entry) []byte {
+	if enc.layout != nil {
+		buf = enc.layout.append(buf, e, &enc)
+		return appendStack(buf, e.Stack)
+	}
+
+	t := e.Time
+	if enc.loc != nil {
+		t = t.In(enc.loc)
+	}
+	buf = appendHeader(buf, t, enc.format, e.Pid, e.File, e.Line, e.Function, e.Level.shortString())
+	buf = appendEscaped(buf, e.Message, enc.escape)
+	buf = appendFields(buf, e.Fields)
+	return appendStack(buf, e.Stack)
+}
+
+//stack as continuation lines, then line ending
+func appendStack(buf []byte, stack string) []byte {
+	if len(stack) != 0 {
+		buf = append(buf, '\n')
+		buf = append(buf, stack...)
+	}
+	return append(buf, '\n')
+}
+
+
+//json:
+
+//json encoder with timestamps in zone loc (nil: local). time format is always
+//RFC 3339 with microseconds for consumers, TimeFormat is not used.
+func NewJSONEncoder(loc *time.Location) Encoder {
+	return jsonEncoder{loc: loc}
+}
+
+type jsonEncoder struct {
+	loc *time.Location
+}
+
+func (enc jsonEncoder) Encode(buf []byte, e *Entry) []byte {
+	t := e.Time
+	if enc.loc != nil {
+		t = t.In(enc.loc)
+	}
+	buf = append(buf, `{"time":"`...)
+	buf = appendTime(buf, t, TimeRFC3339)
+	buf = append(buf, `","level":"`...)
+	buf = append(buf, e.Level.String()...)
+	buf = append(buf, `","pid":`...)
+	buf = strconv.AppendInt(buf, int64(e.Pid), 10)
+	buf = append(buf, `,"caller":"`...)
+	buf = appendJSONEscaped(buf, e.File)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(e.Line), 10)
+	if len(e.Function) != 0 {
+		buf = append(buf, `","func":"`...)
+		buf = appendJSONEscaped(buf, e.Function)
+	}
+	buf = append(buf, `","msg":`...)
+	buf = appendJSONString(buf, e.Message)
+	for i := range e.Fields {
+		buf = append(buf, ',')
+		buf = appendJSONString(buf, e.Fields[i].Key)
+		buf = append(buf, ':')
+		buf = appendJSONValue(buf, e.Fields[i].Value)
+	}
+	if len(e.Stack) != 0 {
+		buf = append(buf, `,"stack":`...)
+		buf = appendJSONString(buf, e.Stack)
+	}
+	return append(buf, "}\n"...)
+}
+
+//field value to json
+func appendJSONValue(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...)
+	case string:
+		return appendJSONString(buf, v)
+	case []byte:
+		return appendJSONString(buf, b2s(v))
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case float32:
+		return appendJSONFloat(buf, float64(v), 32)
+	case float64:
+		return appendJSONFloat(buf, v, 64)
+	case time.Duration:
+		return appendJSONString(buf, v.String())
+	case time.Time:
+		return appendJSONString(buf, v.Format(time.RFC3339Nano))
+	case error:
+		return appendJSONString(buf, v.Error())
+	case fmt.Stringer:
+		return appendJSONString(buf, v.String())
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return appendJSONString(buf, fmt.Sprint(v))
+		}
+		return append(buf, data...)
+	}
+}
+
+//NaN and Inf are not valid json numbers
+func appendJSONFloat(buf []byte, f float64, bitSize int) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		buf = append(buf, '"')
+		buf = strconv.AppendFloat(buf, f, 'g', -1, bitSize)
+		return append(buf, '"')
+	}
+	return strconv.AppendFloat(buf, f, 'g', -1, bitSize)
+}
+
+const hexDigits = "0123456789abcdef"
+
+//quoted json string
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	buf = appendJSONEscaped(buf, s)
+	return append(buf, '"')
+}
+
+//json string content without quotes
+func appendJSONEscaped(buf []byte, s string) []byte {
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= ' ' && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c >> 4], hexDigits[c & 0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	return append(buf, s[start:]...)
+}
@@ -0,0 +1,97 @@
+package purelog
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+//escaping of messages, see Config.SetEscape and EscapeEncoder
+type Escape uint32
+const (
+	EscapeOff     Escape = iota  //write messages as is (default)
+	EscapeControl                //write newlines as \n, other control characters as \r, \x1b, \u009b...
+	EscapeIndent                 //indent continuation lines by a tab, escape other control characters
+)
+
+//text or console encoder enc escaping messages in mode, e.g. for sinks:
+//
+//	NewWriterSink(os.Stderr).SetEncoder(EscapeEncoder(TextEncoder, EscapeControl))
+//
+//json always escapes, other encoders are returned as is.
+func EscapeEncoder(enc Encoder, mode Escape) Encoder {
+	switch e := enc.(type) {
+	case textEncoder:
+		e.escape = mode
+		return e
+	case consoleEncoder:
+		e.escape = mode
+		return e
+	}
+	return enc
+}
+
+//append s, escaping newlines, carriage returns, ansi escapes, other control
+//and non-printable characters unless mode is EscapeOff. tabs are kept.
+func appendEscaped(buf []byte, s string, mode Escape) []byte {
+	if mode == EscapeOff {
+		return append(buf, s...)
+	}
+
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= ' ' && c != 0x7f || c == '\t' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch {
+			case c == '\n' && mode == EscapeIndent:
+				buf = append(buf, '\n', '\t')
+			case c == '\n':
+				buf = append(buf, '\\', 'n')
+			case c == '\r':
+				buf = append(buf, '\\', 'r')
+			default:
+				buf = append(buf, '\\', 'x', hexDigits[c >> 4], hexDigits[c & 0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			//invalid utf-8
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'x', hexDigits[c >> 4], hexDigits[c & 0xf])
+		} else if !strconv.IsPrint(r) {
+			//c1 controls (e.g. \u009b csi), line separators, bidi overrides...
+			buf = append(buf, s[start:i]...)
+			buf = appendRuneEscape(buf, r)
+		} else {
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	return append(buf, s[start:]...)
+}
+
+//\uXXXX or \UXXXXXXXX
+func appendRuneEscape(buf []byte, r rune) []byte {
+	n := 4
+	buf = append(buf, '\\', 'u')
+	if r > 0xffff {
+		n = 8
+		buf[len(buf) - 1] = 'U'
+	}
+	for shift := uint(n - 1) * 4; ; shift -= 4 {
+		buf = append(buf, hexDigits[r >> shift & 0xf])
+		if shift == 0 {
+			return buf
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package purelog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//key-value pair attached to log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+//new field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+
+//utils:
+
+// key=value key2="value 2"
+func appendFields(buf []byte, fields []Field) []byte {
+	for i := range fields {
+		buf = append(buf, ' ')
+		buf = appendKey(buf, fields[i].Key)
+		buf = append(buf, '=')
+		buf = appendValue(buf, fields[i].Value)
+	}
+	return buf
+}
+
+//key with control characters, '=' and spaces escaped, so it can't forge fields
+func appendKey(buf []byte, key string) []byte {
+	for {
+		i := strings.IndexAny(key, "= ")
+		if i == -1 {
+			return appendEscaped(buf, key, EscapeControl)
+		}
+		buf = appendEscaped(buf, key[:i], EscapeControl)
+		buf = append(buf, '\\', 'x', hexDigits[key[i] >> 4], hexDigits[key[i] & 0xf])
+		key = key[i + 1:]
+	}
+}
+
+//field value to string
+func appendValue(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "nil"...)
+	case string:
+		return appendString(buf, v)
+	case []byte:
+		return appendString(buf, b2s(v))
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(buf, v, 10)
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(buf, v, 10)
+	case float32:
+		return strconv.AppendFloat(buf, float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.AppendFloat(buf, v, 'g', -1, 64)
+	case time.Duration:
+		return append(buf, v.String()...)
+	case error:
+		return appendString(buf, v.Error())
+	case fmt.Stringer:
+		return appendString(buf, v.String())
+	default:
+		return appendString(buf, fmt.Sprint(v))
+	}
+}
+
+//quote string if need
+func appendString(buf []byte, s string) []byte {
+	if needQuote(s) {
+		return strconv.AppendQuote(buf, s)
+	}
+	return append(buf, s...)
+}
+
+func needQuote(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		//non-printable or invalid, escaped by quoting
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 || !strconv.IsPrint(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
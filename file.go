@@ -0,0 +1,150 @@
+package purelog
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+//file output with size/count rotation
+type fileWriter struct {
+	files []string  //rotated files, oldest first
+	err   error     //first error of current write
+}
+
+//write data to file, rotate when file reaches size (0 means unlimited)
+//and keep at most count rotated files (0 means unlimited).
+//ends are end offsets of entries in data, files are only cut there.
+func (w *fileWriter) write(file string, data []byte, ends []int, size uint64, count uint32, clock Clock) error {
+	w.err = nil
+
+	//rotate
+	if size != 0 {
+		data = w.rotate(file, data, ends, size, count, clock)
+	}
+
+	//sync to disk
+	w.sync(file, data)
+	return w.err
+}
+
+//record first error
+func (w *fileWriter) fail(format string, args ...interface{}) {
+	if w.err == nil {
+		w.err = fmt.Errorf(format, args...)
+	}
+}
+
+//sync write data to file
+func (w *fileWriter) sync(file string, data []byte) {
+	dir, _ := reverseSplitN(file, 1, '/')
+	_ = os.MkdirAll(dir, os.ModePerm)
+
+	out, err := os.OpenFile(file, os.O_CREATE | os.O_APPEND | os.O_WRONLY | os.O_SYNC, 0666)
+	if err != nil {
+		w.fail("logger.sync: open log file %s err: %v", file, err)
+		return
+	}
+	defer out.Close()
+
+	_, err = out.Write(data)
+	if err != nil {
+		w.fail("logger.sync: write log file %s err: %v", file, err)
+		return
+	}
+	_ = out.Sync()
+}
+
+func (w *fileWriter) rotate(file string, data []byte, ends []int, size uint64, count uint32, clock Clock) []byte {
+	off := 0
+	for off < len(data) {
+		fileSz := fileSize(file)
+		if fileSz >= size {
+			//already full (e.g. size turned down), rotate first
+			w.rotateFile(file, count, clock)
+			if fileSize(file) >= size {
+				break  //can't rotate, append to current file
+			}
+			continue
+		}
+
+		if uint64(len(data) - off) + fileSz >= size {
+			//whole entries fitting rest of file
+			end := -1
+			if i := sort.SearchInts(ends, off + int(size - fileSz) + 1) - 1; i >= 0 && ends[i] > off {
+				end = ends[i]
+			}
+			switch {
+			case end != -1:
+				w.sync(file, data[off:end])
+				off = end
+			case fileSz != 0:
+				//entry doesn't fit rest of file, start it in next file
+				w.rotateFile(file, count, clock)
+				if fileSize(file) != 0 {
+					return data[off:]  //can't rotate, append to current file
+				}
+				continue
+			default:
+				//entry longer than file (see Config.SetMaxMessageSize), keep it whole
+				end = len(data)
+				if i := sort.SearchInts(ends, off + 1); i < len(ends) {
+					end = ends[i]
+				}
+				w.sync(file, data[off:end])
+				off = end
+			}
+			//do rotate
+			w.rotateFile(file, count, clock)
+			continue
+		}
+
+		break
+	}
+	return data[off:]
+}
+
+func (w *fileWriter) rotateFile(file string, count uint32, clock Clock) {
+	//gen new file name
+	name, ext := reverseSplitN(file, 1, '.')
+	var arr [128]byte
+	var newFile string
+	for now := clock.Now(); ; now = now.Add(1) {
+		buf := append(arr[:0], name...)
+		buf = append(buf, '_')
+		buf = appendRotateTime(buf, now)
+		buf = append(buf, '.')
+		buf = append(buf, ext...)
+		newFile = string(buf)
+
+		//rename replaces existing file, e.g. rotated twice in clock resolution
+		if _, err := os.Lstat(newFile); err != nil {
+			break
+		}
+	}
+
+	//move file
+	err := os.Rename(file, newFile)
+	if err != nil {
+		w.fail("logger.rotate: move file %s to %s err: %v", file, newFile, err)
+		os.Remove(file)
+		return
+	}
+
+	//add to files
+	w.files = append(w.files, newFile)
+
+	//clean older
+	w.clean(count)
+}
+
+func (w *fileWriter) clean(count uint32) {
+	if count != 0 && uint32(len(w.files)) >= count {
+		file := w.files[0]
+		err := os.Remove(file)
+		if err != nil {
+			w.fail("logger.clean: remove log file %s err: %v", file, err)
+		}
+		w.files = w.files[1:]
+	}
+}
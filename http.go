@@ -0,0 +1,345 @@
+package purelog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	httpBatchSize  = 1024 * 1024       //max request body (before compression): 1MB
+	httpQueueSize  = 16 * 1024 * 1024  //max data kept for retry: 16MB
+	httpTimeout    = 10 * time.Second  //request timeout of default client
+	httpBackoffMin = time.Second       //first retry delay
+	httpBackoffMax = time.Minute       //max retry delay
+)
+
+var errHTTPBackoff = errors.New("http: waiting to retry")
+
+//sink posts batches of encoded entries (NDJSON by default) to a log collector on each flush
+//
+//failed batches are queued (bounded, oldest dropped) and retried on a later flush,
+//after a delay doubling on each failure, so a failing collector doesn't stall flushes.
+type HTTPSink struct {
+	level      uint32
+	gzip       uint32
+	retry      uint32
+	batchSize  uint64
+	queueSize  uint64
+	encoder    atomic.Value
+	url        string
+	client     *http.Client
+	header     http.Header
+	backoffMin time.Duration
+	backoffMax time.Duration
+	db         doubleBuffer
+
+	//used by flush only
+	queue      [][]byte
+	queued     int
+	backoff    time.Duration
+	retryAt    time.Time
+	down       bool  //failure reported
+	zbuf       bytes.Buffer
+	zw         *gzip.Writer
+}
+
+//new http sink posting to url
+//
+//default level is debug, encoder is JSONEncoder, batch size is 1MB, queue size is 16MB,
+//no immediate retry and retry delay from 1s to 1m.
+func NewHTTPSink(url string) *HTTPSink {
+	s := &HTTPSink{
+		url:        url,
+		batchSize:  httpBatchSize,
+		queueSize:  httpQueueSize,
+		client:     &http.Client{Timeout: httpTimeout},
+		header:     http.Header{},
+		backoffMin: httpBackoffMin,
+		backoffMax: httpBackoffMax,
+	}
+	s.header.Set("Content-Type", "application/x-ndjson")
+	s.encoder.Store(encoderHolder{JSONEncoder})
+	s.db.init()
+	return s
+}
+
+func (s *HTTPSink) SetLevel(level Level) *HTTPSink {
+	atomic.StoreUint32(&s.level, uint32(level))
+	return s
+}
+
+func (s *HTTPSink) SetEncoder(encoder Encoder) *HTTPSink {
+	s.encoder.Store(encoderHolder{encoder})
+	return s
+}
+
+//enable gzip request body
+func (s *HTTPSink) SetGzip(enb bool) *HTTPSink {
+	atomic.StoreUint32(&s.gzip, bool2uint32(enb))
+	return s
+}
+
+//set immediate retry count of a request failed in transport (e.g. connection reset).
+//408, 429 and 5xx responses are only retried after backoff.
+func (s *HTTPSink) SetRetry(retry uint) *HTTPSink {
+	atomic.StoreUint32(&s.retry, uint32(retry))
+	return s
+}
+
+//set retry delay range, the delay doubles on each failure, must be called before logging
+func (s *HTTPSink) SetBackoff(min, max time.Duration) *HTTPSink {
+	s.backoffMin = min
+	s.backoffMax = maxDuration(min, max)
+	return s
+}
+
+//set max request body size, entries are never split
+func (s *HTTPSink) SetBatchSize(size uint) *HTTPSink {
+	atomic.StoreUint64(&s.batchSize, uint64(size))
+	return s
+}
+
+//set max size of failed batches kept for retry, 0 means no retry queue
+func (s *HTTPSink) SetQueueSize(size uint) *HTTPSink {
+	atomic.StoreUint64(&s.queueSize, uint64(size))
+	return s
+}
+
+//set http client, must be called before logging
+func (s *HTTPSink) SetClient(client *http.Client) *HTTPSink {
+	s.client = client
+	return s
+}
+
+//set request header (e.g. Authorization), must be called before logging
+func (s *HTTPSink) SetHeader(key, value string) *HTTPSink {
+	s.header.Set(key, value)
+	return s
+}
+
+func (s *HTTPSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.level))
+}
+
+func (s *HTTPSink) Write(e *Entry) {
+	s.db.write(s.encoder.Load().(encoderHolder).Encoder, e)
+}
+
+func (s *HTTPSink) Flush() error {
+	buf := s.db.swap()
+	defer s.db.recycle()
+	if buf.Len() == 0 && len(s.queue) == 0 {
+		return nil
+	}
+	if time.Now().Before(s.retryAt) {
+		return s.fail(buf.Data, errHTTPBackoff, nil)
+	}
+
+	var firstErr error
+	report := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	//queued batches first, keep order
+	for len(s.queue) != 0 {
+		batch := s.queue[0]
+		if err := s.post(batch); err != nil {
+			if !isRetryable(err) {
+				report(err)
+			} else {
+				return s.fail(buf.Data, err, firstErr)
+			}
+		}
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.queued -= len(batch)
+	}
+
+	size := int(atomic.LoadUint64(&s.batchSize))
+	for data := buf.Data; len(data) != 0; {
+		batch, rest := nextBatch(data, size)
+		if err := s.post(batch); err != nil {
+			if !isRetryable(err) {
+				report(err)
+			} else {
+				return s.fail(data, err, firstErr)
+			}
+		}
+		data = rest
+	}
+
+	s.down = false
+	s.backoff = 0
+	return firstErr
+}
+
+//flush, retrying queued batches without waiting for backoff
+func (s *HTTPSink) Close() error {
+	s.db.fmtx.Lock()
+	s.retryAt = time.Time{}
+	s.db.fmtx.Unlock()
+	return s.Flush()
+}
+
+//queue unsent data, report only first failure and drops
+func (s *HTTPSink) fail(data []byte, cause, firstErr error) error {
+	if cause != errHTTPBackoff {
+		//exponential backoff
+		s.backoff = maxDuration(s.backoffMin, s.backoff * 2)
+		if s.backoff > s.backoffMax {
+			s.backoff = s.backoffMax
+		}
+		s.retryAt = time.Now().Add(s.backoff)
+	}
+
+	err := firstErr
+	if !s.down {
+		s.down = true
+		if err == nil {
+			err = fmt.Errorf("http: post to %s err: %v", s.url, cause)
+		}
+	}
+
+	//split into batches, copy out of the recycled buffer
+	size := int(atomic.LoadUint64(&s.batchSize))
+	for len(data) != 0 {
+		batch, rest := nextBatch(data, size)
+		s.queue = append(s.queue, append([]byte(nil), batch...))
+		s.queued += len(batch)
+		data = rest
+	}
+
+	//bounded, drop oldest
+	dropped := 0
+	for s.queued > int(atomic.LoadUint64(&s.queueSize)) && len(s.queue) != 0 {
+		dropped += len(s.queue[0])
+		s.queued -= len(s.queue[0])
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+	}
+	if dropped != 0 {
+		return fmt.Errorf("http: retry queue full, dropped %d bytes: %v", dropped, cause)
+	}
+	return err
+}
+
+//post batch with immediate retries of transport errors
+func (s *HTTPSink) post(batch []byte) error {
+	body, gz := batch, atomic.LoadUint32(&s.gzip) != 0
+	if gz {
+		var err error
+		if body, err = s.compress(batch); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for i := uint32(0); i <= atomic.LoadUint32(&s.retry); i++ {
+		if err = s.do(body, gz); err == nil {
+			return nil
+		}
+		if _, ok := err.(httpTransportError); !ok {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *HTTPSink) do(body []byte, gz bool) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	if gz {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return httpTransportError{err}
+	}
+	//drain for connection reuse
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64 * 1024))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return httpStatusError(resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *HTTPSink) compress(data []byte) ([]byte, error) {
+	s.zbuf.Reset()
+	if s.zw == nil {
+		s.zw = gzip.NewWriter(&s.zbuf)
+	} else {
+		s.zw.Reset(&s.zbuf)
+	}
+	if _, err := s.zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := s.zw.Close(); err != nil {
+		return nil, err
+	}
+	return s.zbuf.Bytes(), nil
+}
+
+//unexpected response status
+type httpStatusError int
+
+func (code httpStatusError) Error() string {
+	return fmt.Sprintf("http: unexpected status %d %s", int(code), http.StatusText(int(code)))
+}
+
+//failed request, e.g. connection refused or timeout
+type httpTransportError struct {
+	err error
+}
+
+func (e httpTransportError) Error() string {
+	return e.err.Error()
+}
+
+func (e httpTransportError) Unwrap() error {
+	return e.err
+}
+
+//transport errors, 408, 429 and 5xx are worth retrying. others (bad url,
+//compression...) fail again, the batch is dropped.
+func isRetryable(err error) bool {
+	switch e := err.(type) {
+	case httpTransportError:
+		return true
+	case httpStatusError:
+		return e == http.StatusRequestTimeout || e == http.StatusTooManyRequests || e >= 500
+	}
+	return false
+}
+
+//returns leading whole lines up to size (at least one line) and the rest
+func nextBatch(data []byte, size int) ([]byte, []byte) {
+	if size <= 0 || len(data) <= size {
+		return data, nil
+	}
+	n := reverseIndexB(data[:size], 1, '\n') + 1
+	if n == 0 {
+		//single line longer than size
+		n = bytes.IndexByte(data, '\n') + 1
+		if n == 0 {
+			n = len(data)
+		}
+	}
+	return data[:n], data[n:]
+}
@@ -0,0 +1,321 @@
+//go:build linux
+// +build linux
+
+package purelog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+//sink writes to systemd-journald with native protocol
+//
+//each entry is a datagram of KEY=value fields; entries too large for a datagram
+//are written to an unlinked temp file in /dev/shm and its descriptor is sent instead.
+//
+//entries are dropped while journald is unavailable, the count is reported once it's back.
+type JournalSink struct {
+	level       uint32
+	socket      string
+	identifier  string
+	db          doubleBuffer
+	conn        *net.UnixConn
+	maxDatagram int  //send larger entries by descriptor (0: only when kernel refuses)
+	down        bool  //send failure reported
+	dropped     int   //entries dropped since send failure reported
+}
+
+//new journald sink, empty socket means /run/systemd/journal/socket.
+//
+//default level is debug, SYSLOG_IDENTIFIER is program name.
+func NewJournalSink(socket string) *JournalSink {
+	if len(socket) == 0 {
+		socket = journalSocket
+	}
+	s := &JournalSink{
+		socket:     socket,
+		identifier: filepath.Base(os.Args[0]),
+	}
+	s.db.init()
+	return s
+}
+
+func (s *JournalSink) SetLevel(level Level) *JournalSink {
+	atomic.StoreUint32(&s.level, uint32(level))
+	return s
+}
+
+//set SYSLOG_IDENTIFIER, must be called before logging
+func (s *JournalSink) SetIdentifier(identifier string) *JournalSink {
+	s.identifier = identifier
+	return s
+}
+
+func (s *JournalSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.level))
+}
+
+func (s *JournalSink) Write(e *Entry) {
+	s.db.write(journalEncoder{s}, e)
+}
+
+func (s *JournalSink) Flush() error {
+	buf := s.db.swap()
+	defer s.db.recycle()
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	rest, err := s.send(buf.Data)
+	if err == nil {
+		if !s.down {
+			return nil
+		}
+		dropped := s.dropped
+		s.down, s.dropped = false, 0
+		if dropped == 0 {
+			return nil
+		}
+		return fmt.Errorf("journal: %d entries dropped while %s was unavailable", dropped, s.socket)
+	}
+
+	dropped := countFrames(rest)
+	if s.down {
+		s.dropped += dropped
+		return nil
+	}
+	s.down = true
+	return fmt.Errorf("journal: send to %s err: %v, %d entries dropped", s.socket, err, dropped)
+}
+
+func (s *JournalSink) Close() error {
+	err := s.Flush()
+
+	s.db.fmtx.Lock()
+	defer s.db.fmtx.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+//send framed entries, reconnect once on failure. returns unsent data.
+func (s *JournalSink) send(data []byte) ([]byte, error) {
+	var err error
+	for retry := 0; retry < 2; retry++ {
+		if s.conn == nil {
+			var conn net.Conn
+			conn, err = net.DialTimeout("unixgram", s.socket, syslogDialTimeout)
+			if err != nil {
+				continue
+			}
+			s.conn = conn.(*net.UnixConn)
+		}
+
+		data, err = s.write(data)
+		if err == nil {
+			return nil, nil
+		}
+
+		//broken connection, reconnect
+		s.conn.Close()
+		s.conn = nil
+	}
+	return data, err
+}
+
+//write framed entries, returns unsent data on error
+func (s *JournalSink) write(data []byte) ([]byte, error) {
+	for len(data) != 0 {
+		msg, next := nextFrame(data)
+		if msg == nil {
+			return nil, errors.New("journal: bad frame")
+		}
+
+		var err error
+		if s.maxDatagram != 0 && len(msg) > s.maxDatagram {
+			err = s.writeFd(msg)
+		} else {
+			_, err = s.conn.Write(msg)
+			if isMsgTooLarge(err) {
+				err = s.writeFd(msg)
+			}
+		}
+		if err != nil {
+			return data, err
+		}
+		data = next
+	}
+	return nil, nil
+}
+
+//write oversized entry to temp file and send the descriptor
+func (s *JournalSink) writeFd(msg []byte) error {
+	file, err := tempShm(msg)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	//WriteMsgUnix refuses connected datagram socket, sendmsg directly
+	rc, err := s.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(file.Fd()))
+	werr := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+func isMsgTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+//unlinked temp file holding data, memory backed if /dev/shm exists
+func tempShm(data []byte) (*os.File, error) {
+	file, err := ioutil.TempFile("/dev/shm", "purelog-")
+	if err != nil {
+		file, err = ioutil.TempFile("", "purelog-")
+		if err != nil {
+			return nil, err
+		}
+	}
+	os.Remove(file.Name())
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+
+//encoder:
+
+//journal encoder, emits "LEN SP FIELDS"
+type journalEncoder struct {
+	s *JournalSink
+}
+
+func (enc journalEncoder) Encode(buf []byte, e *Entry) []byte {
+	beg := len(buf)
+
+	buf = appendJournalField(buf, "MESSAGE", e.Message)
+	buf = append(buf, "PRIORITY="...)
+	buf = strconv.AppendInt(buf, int64(syslogSeverity(e.Level)), 10)
+	buf = append(buf, '\n')
+	if len(enc.s.identifier) != 0 {
+		buf = appendJournalField(buf, "SYSLOG_IDENTIFIER", enc.s.identifier)
+	}
+	buf = appendJournalField(buf, "CODE_FILE", e.File)
+	buf = append(buf, "CODE_LINE="...)
+	buf = strconv.AppendInt(buf, int64(e.Line), 10)
+	buf = append(buf, '\n')
+	if len(e.Function) != 0 {
+		buf = appendJournalField(buf, "CODE_FUNC", e.Function)
+	}
+
+	for i := range e.Fields {
+		var arr [64]byte
+		key := appendJournalKey(arr[:0], e.Fields[i].Key)
+		switch v := e.Fields[i].Value.(type) {
+		case string:
+			buf = appendJournalField(buf, b2s(key), v)
+		case []byte:
+			buf = appendJournalField(buf, b2s(key), b2s(v))
+		default:
+			var varr [64]byte
+			buf = appendJournalField(buf, b2s(key), b2s(appendValue(varr[:0], v)))
+		}
+	}
+
+	return prependLength(buf, beg)
+}
+
+//KEY=value\n, or KEY\n<le64 size>value\n if value contains newline
+func appendJournalField(buf []byte, key, value string) []byte {
+	buf = append(buf, key...)
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\n' {
+			var size [8]byte
+			binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+			buf = append(buf, '\n')
+			buf = append(buf, size[:]...)
+			buf = append(buf, value...)
+			return append(buf, '\n')
+		}
+	}
+	buf = append(buf, '=')
+	buf = append(buf, value...)
+	return append(buf, '\n')
+}
+
+//fields written by journalEncoder and well-known journal fields, prefixed with F_
+//when used as field keys so they can't be spoofed. leading underscores of trusted
+//fields (_PID, _UID...) are already dropped.
+var journalReserved = map[string]bool{
+	"MESSAGE":            true,
+	"MESSAGE_ID":         true,
+	"PRIORITY":           true,
+	"CODE_FILE":          true,
+	"CODE_LINE":          true,
+	"CODE_FUNC":          true,
+	"ERRNO":              true,
+	"TID":                true,
+	"SYSLOG_IDENTIFIER":  true,
+	"SYSLOG_FACILITY":    true,
+	"SYSLOG_PID":         true,
+	"SYSLOG_TIMESTAMP":   true,
+	"SYSLOG_RAW":         true,
+	"DOCUMENTATION":      true,
+	"INVOCATION_ID":      true,
+	"USER_INVOCATION_ID": true,
+}
+
+//journal field name: uppercase letters, digits and underscores, not starting with underscore
+//or digit, F_ prefixed if reserved
+func appendJournalKey(buf []byte, key string) []byte {
+	beg := len(buf)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			c = '_'
+		}
+		if len(buf) == beg && (c == '_' || (c >= '0' && c <= '9')) {
+			if c == '_' {
+				continue
+			}
+			buf = append(buf, 'F', '_')
+		}
+		buf = append(buf, c)
+	}
+	if len(buf) == beg {
+		return append(buf, "FIELD"...)
+	}
+	if journalReserved[string(buf[beg:])] {
+		buf = append(buf, 0, 0)
+		copy(buf[beg + 2:], buf[beg:])
+		buf[beg], buf[beg + 1] = 'F', '_'
+	}
+	return buf
+}
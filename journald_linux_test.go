@@ -0,0 +1,146 @@
+package purelog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJournalSink(t *testing.T) {
+	addr := filepath.Join(tempFile(t, ""), "journal.sock")
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	sink := NewJournalSink(addr).SetIdentifier("app")
+	sink.maxDatagram = 256
+	logger := New(NewConfig().SetCaller(true).SetStderr(true).AddSink(sink))
+
+	ctx := NewContext(context.Background(), F("request-id", "abc"), F("_private", 1), F("2fa", true), F("priority", "0"), F("_MESSAGE", "spoofed"))
+	logger.WarnCtx(ctx, "multi\nline")
+	logger.Error(strings.Repeat("x", 1024))
+	logger.Close()
+
+	//small entry in datagram
+	fields := readJournal(t, ln)
+	for key, want := range map[string]string{
+		"MESSAGE":           "multi\nline",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "app",
+		"REQUEST_ID":        "abc",
+		"PRIVATE":           "1",
+		"F_2FA":             "true",
+		"F_PRIORITY":        "0",
+		"F_MESSAGE":         "spoofed",
+	} {
+		if fields[key] != want {
+			t.Errorf("field %s = %q, want %q", key, fields[key], want)
+		}
+	}
+	if !strings.HasSuffix(fields["CODE_FILE"], "journald_linux_test.go") || fields["CODE_LINE"] == "" {
+		t.Errorf("unexpected caller: %s:%s", fields["CODE_FILE"], fields["CODE_LINE"])
+	}
+
+	//oversized entry by descriptor
+	fields = readJournal(t, ln)
+	if fields["MESSAGE"] != strings.Repeat("x", 1024) || fields["PRIORITY"] != "3" {
+		t.Errorf("unexpected oversized entry: %v", fields)
+	}
+}
+
+func TestJournalSinkDown(t *testing.T) {
+	addr := filepath.Join(tempFile(t, ""), "journal.sock")
+	sink := NewJournalSink(addr)
+	write := func(n int) {
+		for i := 0; i < n; i++ {
+			sink.Write(&Entry{Level: LevelInfo, Message: "msg"})
+		}
+	}
+
+	//failure reported once with dropped count
+	write(2)
+	if err := sink.Flush(); err == nil || !strings.Contains(err.Error(), "2 entries dropped") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	write(3)
+	if err := sink.Flush(); err != nil {
+		t.Errorf("failure reported again: %v", err)
+	}
+
+	//dropped count reported when journald is back
+	ln, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	write(1)
+	if err := sink.Flush(); err == nil || !strings.Contains(err.Error(), "3 entries dropped while") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fields := readJournal(t, ln); fields["MESSAGE"] != "msg" {
+		t.Errorf("unexpected entry: %v", fields)
+	}
+	write(1)
+	if err := sink.Flush(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	sink.Close()
+}
+
+//read one entry, following passed descriptor if any
+func readJournal(t *testing.T, ln *net.UnixConn) map[string]string {
+	buf := make([]byte, 64 * 1024)
+	oob := make([]byte, 1024)
+	ln.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := ln.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+
+	if oobn != 0 {
+		msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("bad control message: %v", err)
+		}
+		fds, err := syscall.ParseUnixRights(&msgs[0])
+		if err != nil || len(fds) != 1 {
+			t.Fatalf("bad unix rights: %v", err)
+		}
+		file := os.NewFile(uintptr(fds[0]), "journal")
+		defer file.Close()
+		file.Seek(0, 0)
+		if data, err = ioutil.ReadAll(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fields := map[string]string{}
+	for len(data) != 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i == -1 {
+			t.Fatalf("bad entry: %q", data)
+		}
+		key := string(data[:i])
+		if data[i] == '=' {
+			end := bytes.IndexByte(data, '\n')
+			fields[key] = string(data[i+1 : end])
+			data = data[end+1:]
+			continue
+		}
+		size := int(binary.LittleEndian.Uint64(data[i+1:]))
+		fields[key] = string(data[i+9 : i+9+size])
+		data = data[i+9+size+1:]
+	}
+	return fields
+}
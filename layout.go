@@ -0,0 +1,141 @@
+package purelog
+
+import (
+	"os"
+	"strings"
+)
+
+//default text layout, same as appendHeader
+const DefaultLayout = "{time} {pid} {caller} {level} | {msg}"
+
+//appends part of an entry
+type appender func(buf []byte, e *Entry, enc *textEncoder) []byte
+
+//text layout compiled into appenders
+type layout struct {
+	appenders []appender
+}
+
+//compile layout template, see Config.SetLayout for placeholders
+func compileLayout(s string) *layout {
+	l := &layout{}
+	fields := strings.Contains(s, "{fields}")
+
+	for len(s) != 0 {
+		beg := strings.IndexByte(s, '{')
+		end := -1
+		if beg != -1 {
+			end = strings.IndexByte(s[beg:], '}')
+		}
+		if end == -1 {
+			l.literal(s)
+			break
+		}
+		end += beg
+
+		if a := placeholder(s[beg + 1 : end], fields); a != nil {
+			l.literal(s[:beg])
+			l.appenders = append(l.appenders, a)
+		} else {
+			l.literal(s[:end + 1])
+		}
+		s = s[end + 1:]
+	}
+	return l
+}
+
+//add literal text
+func (l *layout) literal(text string) {
+	if len(text) == 0 {
+		return
+	}
+	l.appenders = append(l.appenders, func(buf []byte, e *Entry, enc *textEncoder) []byte {
+		return append(buf, text...)
+	})
+}
+
+func placeholder(name string, fields bool) appender {
+	switch name {
+	case "time":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			t := e.Time
+			if enc.loc != nil {
+				t = t.In(enc.loc)
+			}
+			buf = enc.colorOn(buf, ansiDim)
+			buf = appendTime(buf, t, enc.format)
+			return enc.colorOff(buf)
+		}
+	case "pid":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			return appendInt(buf, e.Pid)
+		}
+	case "caller":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			buf = enc.colorOn(buf, ansiDim)
+			buf = append(buf, e.File...)
+			buf = append(buf, ':')
+			buf = appendInt(buf, e.Line)
+			if len(e.Function) != 0 {
+				buf = append(buf, ' ')
+				buf = append(buf, e.Function...)
+			}
+			return enc.colorOff(buf)
+		}
+	case "func":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			return append(buf, e.Function...)
+		}
+	case "file":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			return append(buf, e.File...)
+		}
+	case "line":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			return appendInt(buf, e.Line)
+		}
+	case "level":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			buf = enc.colorOn(buf, levelColor(e.Level))
+			buf = append(buf, e.Level.shortString()...)
+			return enc.colorOff(buf)
+		}
+	case "name":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			return append(buf, enc.name...)
+		}
+	case "host":
+		host, _ := os.Hostname()
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			return append(buf, host...)
+		}
+	case "msg":
+		if fields {
+			return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+				return appendEscaped(buf, e.Message, enc.escape)
+			}
+		}
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			buf = appendEscaped(buf, e.Message, enc.escape)
+			return appendFields(buf, e.Fields)
+		}
+	case "fields":
+		return func(buf []byte, e *Entry, enc *textEncoder) []byte {
+			if len(e.Fields) == 0 {
+				return buf
+			}
+			//without leading space
+			beg := len(buf)
+			buf = appendFields(buf, e.Fields)
+			return append(buf[:beg], buf[beg + 1:]...)
+		}
+	}
+	return nil
+}
+
+func (l *layout) append(buf []byte, e *Entry, enc *textEncoder) []byte {
+	for _, a := range l.appenders {
+		buf = a(buf, e, enc)
+	}
+	return buf
+}
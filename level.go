@@ -6,20 +6,30 @@ const (
 	LevelInfo
 	LevelWarn
 	LevelError
+	LevelOff   //disable output, higher than all levels
 )
 
+//level of name (debug) or short name (DBG), LevelDebug if unknown
 func ParseLevel(level string) Level {
+	l, _ := LookupLevel(level)
+	return l
+}
+
+//level of name (debug) or short name (DBG), false if unknown
+func LookupLevel(level string) (Level, bool) {
 	switch level {
 	case "debug", "DBG":
-		return LevelDebug
+		return LevelDebug, true
 	case "info", "INF":
-		return LevelInfo
+		return LevelInfo, true
 	case "warn", "WAR":
-		return LevelWarn
+		return LevelWarn, true
 	case "error", "ERR":
-		return LevelError
+		return LevelError, true
+	case "off", "OFF":
+		return LevelOff, true
 	default:
-		return LevelDebug
+		return LevelDebug, false
 	}
 }
 
@@ -33,6 +43,8 @@ func (level Level) String() string {
 		return "warn"
 	case LevelError:
 		return "error"
+	case LevelOff:
+		return "off"
 	default:
 		return "debug"
 	}
@@ -48,6 +60,8 @@ func (level Level) shortString() string {
 		return "WAR"
 	case LevelError:
 		return "ERR"
+	case LevelOff:
+		return "OFF"
 	default:
 		return "DBG"
 	}
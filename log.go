@@ -1,5 +1,9 @@
 package purelog
 
+import (
+	"context"
+)
+
 var DefaultConfig = NewConfig().
 	SetStderr(true).
 	SetStdout(true).
@@ -39,6 +43,53 @@ func Errorf(format string, args ...interface{}) {
 	DefaultLogger.Logf(LevelError, 1, format, args...)
 }
 
+func DebugCtx(ctx context.Context, args ...interface{}) {
+	DefaultLogger.LogCtx(ctx, LevelDebug, 1, args...)
+}
+
+func InfoCtx(ctx context.Context, args ...interface{}) {
+	DefaultLogger.LogCtx(ctx, LevelInfo, 1, args...)
+}
+
+func WarnCtx(ctx context.Context, args ...interface{}) {
+	DefaultLogger.LogCtx(ctx, LevelWarn, 1, args...)
+}
+
+func ErrorCtx(ctx context.Context, args ...interface{}) {
+	DefaultLogger.LogCtx(ctx, LevelError, 1, args...)
+}
+
+func DebugfCtx(ctx context.Context, format string, args ...interface{}) {
+	DefaultLogger.LogfCtx(ctx, LevelDebug, 1, format, args...)
+}
+
+func InfofCtx(ctx context.Context, format string, args ...interface{}) {
+	DefaultLogger.LogfCtx(ctx, LevelInfo, 1, format, args...)
+}
+
+func WarnfCtx(ctx context.Context, format string, args ...interface{}) {
+	DefaultLogger.LogfCtx(ctx, LevelWarn, 1, format, args...)
+}
+
+func ErrorfCtx(ctx context.Context, format string, args ...interface{}) {
+	DefaultLogger.LogfCtx(ctx, LevelError, 1, format, args...)
+}
+
 func Flush() {
 	DefaultLogger.Flush()
-}
\ No newline at end of file
+}
+
+func Sync() {
+	DefaultLogger.Sync()
+}
+
+//recover and log panic by DefaultLogger, must be deferred directly
+func RecoverAndLog() {
+	if r := recover(); r != nil {
+		DefaultLogger.logPanic(r)
+	}
+}
+
+func Go(fn func()) {
+	DefaultLogger.Go(fn)
+}
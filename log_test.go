@@ -1,9 +1,18 @@
 package purelog
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -276,6 +285,701 @@ func TestNewDir(t *testing.T) {
 	logger.Infof("test dir")
 }
 
+func TestContextFields(t *testing.T) {
+	file := tempFile(t, "ctx.log")
+	logger := New(NewConfig().
+		SetFile(file).
+		SetCaller(true))
+
+	ctx := NewContext(context.Background(), F("request_id", "abc"), F("user_id", 42))
+	ctx = NewContext(ctx, F("tenant", "acme corp"))
+
+	logger.InfoCtx(ctx, "handle")
+	logger.WarnfCtx(ctx, "cost %dms", 15)
+	logger.Info("no fields")
+	logger.Close()
+
+	data := readFile(t, file)
+	for _, want := range []string{
+		"INF | handle request_id=abc user_id=42 tenant=\"acme corp\"\n",
+		"WAR | cost 15ms request_id=abc user_id=42 tenant=\"acme corp\"\n",
+		"INF | no fields\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("missing %q in:\n%s", want, data)
+		}
+	}
+
+	if len(FromContext(context.Background())) != 0 {
+		t.Errorf("unexpected fields in background context")
+	}
+}
+
+func TestContextExtractor(t *testing.T) {
+	file := tempFile(t, "trace.log")
+	logger := New(NewConfig().
+		SetFile(file).
+		SetContextExtractor(TraceparentExtractor))
+
+	ctx := NewContext(context.Background(), F("request_id", "abc"))
+	ctx = WithTraceparent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	logger.InfoCtx(ctx, "traced")
+	logger.InfoCtx(WithTraceparent(context.Background(), "00-invalid"), "untraced")
+	logger.Close()
+
+	data := readFile(t, file)
+	for _, want := range []string{
+		"INF | traced request_id=abc trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7\n",
+		"INF | untraced\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("missing %q in:\n%s", want, data)
+		}
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, c := range []struct {
+		s  string
+		ok bool
+	} {
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"", false},
+	} {
+		if _, _, ok := parseTraceparent(c.s); ok != c.ok {
+			t.Errorf("parseTraceparent(%q) = %v, want %v", c.s, ok, c.ok)
+		}
+	}
+}
+
+func TestSinks(t *testing.T) {
+	debugFile := tempFile(t, "debug.log")
+	errorFile := tempFile(t, "error.log")
+	var warn bytes.Buffer
+
+	logger := New(NewConfig().
+		SetLevel(LevelError).
+		AddSink(NewFileSink(debugFile)).
+		AddSink(NewWriterSink(&warn).SetLevel(LevelWarn).SetEncoder(JSONEncoder)).
+		AddSink(NewFileSink(errorFile).SetLevel(LevelError).SetSize(1024).SetCount(3)))
+
+	ctx := NewContext(context.Background(), F("user", "bob \"b\""), F("n", 3))
+	logger.Debug("debug")
+	logger.WarnCtx(ctx, "warn\tline")
+	logger.Error("error")
+	logger.Close()
+
+	debug := readFile(t, debugFile)
+	if !strings.Contains(debug, "DBG | debug\n") || !strings.Contains(debug, "ERR | error\n") {
+		t.Errorf("unexpected debug sink output:\n%s", debug)
+	}
+
+	if errs := readFile(t, errorFile); strings.Count(errs, "\n") != 1 || !strings.Contains(errs, "ERR | error\n") {
+		t.Errorf("unexpected error sink output:\n%s", errs)
+	}
+
+	lines := strings.Split(strings.TrimSpace(warn.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected warn sink output:\n%s", warn.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid json %s: %v", lines[0], err)
+	}
+	if entry["level"] != "warn" || entry["msg"] != "warn\tline" || entry["user"] != "bob \"b\"" || entry["n"] != 3.0 {
+		t.Errorf("unexpected json entry: %s", lines[0])
+	}
+}
+
+func TestAppendJSONValue(t *testing.T) {
+	for _, c := range []struct {
+		v    interface{}
+		want string
+	} {
+		{nil, `null`},
+		{"a\"b\\c\n\x01", `"a\"b\\c\n\u0001"`},
+		{"\xff", `"\ufffd"`},
+		{42, `42`},
+		{1.5, `1.5`},
+		{math.Inf(1), `"+Inf"`},
+		{true, `true`},
+		{errors.New("boom"), `"boom"`},
+		{map[string]int{"a": 1}, `{"a":1}`},
+	} {
+		if got := string(appendJSONValue(nil, c.v)); got != c.want {
+			t.Errorf("appendJSONValue(%#v) = %s, want %s", c.v, got, c.want)
+		}
+	}
+}
+
+func TestStderrLevel(t *testing.T) {
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	outFile, errFile := tempFile(t, "stdout"), tempFile(t, "stderr")
+	os.Stdout, _ = os.Create(outFile)
+	os.Stderr, _ = os.Create(errFile)
+	defer os.Stdout.Close()
+	defer os.Stderr.Close()
+
+	logger := New(NewConfig().
+		SetStdout(true).
+		SetStderrLevel(LevelWarn))
+	logger.Info("info1")
+	logger.Warn("warn1")
+	logger.Error("error1")
+	logger.Info("info2")
+	logger.Close()
+
+	out, errs := readFile(t, outFile), readFile(t, errFile)
+	if !strings.Contains(out, "INF | info1\n") || !strings.Contains(out, "INF | info2\n") || strings.Contains(out, "warn1") {
+		t.Errorf("unexpected stdout:\n%s", out)
+	}
+	if !strings.Contains(errs, "WAR | warn1\n") || !strings.Contains(errs, "ERR | error1\n") || strings.Contains(errs, "info") {
+		t.Errorf("unexpected stderr:\n%s", errs)
+	}
+
+	//zero Config doesn't route to stderr
+	logger = New(new(Config).SetStdout(true))
+	logger.Error("zero")
+	logger.Close()
+	if out, errs := readFile(t, outFile), readFile(t, errFile); !strings.Contains(out, "ERR | zero\n") || strings.Contains(errs, "zero") {
+		t.Errorf("zero config: unexpected stdout:\n%s\nstderr:\n%s", out, errs)
+	}
+}
+
+func TestColor(t *testing.T) {
+	now := time.Date(2022, 9, 2, 3, 4, 5, 123456000, time.Local)
+	e := &Entry{Time: now, Level: LevelWarn, File: "a/b.go", Line: 7, Message: "msg", Fields: []Field{F("k", "v")}}
+	want := "\x1b[2m2022-09-02 03:04:05.123456\x1b[0m \x1b[33mWAR\x1b[0m \x1b[2ma/b.go:7\x1b[0m                 msg k=v\n"
+	if got := string(NewConsoleEncoder(TimeDefault, nil).Encode(nil, e)); got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	//layout
+	console := consoleEncoder{layout: compileLayout("{level} [{name}] {msg}"), name: "app"}
+	if got, want := string(console.Encode(nil, e)), "\x1b[33mWAR\x1b[0m [app] msg k=v\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	for _, c := range []struct {
+		mode  ColorMode
+		color bool
+	} {
+		{ColorAuto, false},  //not a terminal
+		{ColorAlways, true},
+		{ColorNever, false},
+	} {
+		outFile, file := tempFile(t, "stdout"), tempFile(t, "color.log")
+		os.Stdout, _ = os.Create(outFile)
+
+		logger := New(NewConfig().
+			SetStdout(true).
+			SetFile(file).
+			SetColor(c.mode))
+		logger.Info("hello")
+		logger.Close()
+		os.Stdout.Close()
+
+		out, data := readFile(t, outFile), readFile(t, file)
+		if strings.Contains(out, "\x1b[") != c.color || !strings.Contains(out, "hello") {
+			t.Errorf("mode %d: unexpected stdout: %q", c.mode, out)
+		}
+		if strings.Contains(data, "\x1b[") || !strings.Contains(data, "INF | hello\n") {
+			t.Errorf("mode %d: unexpected file: %q", c.mode, data)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		mode Escape
+		want string
+	} {
+		{"a\nb", EscapeOff, "a\nb"},
+		{"plain\ttext 中文", EscapeControl, "plain\ttext 中文"},
+		{"a\r\nb", EscapeControl, `a\r\nb`},
+		{"a\r\nb", EscapeIndent, "a\\r\n\tb"},
+		{"\x1b[31mred\x1b[0m", EscapeControl, `\x1b[31mred\x1b[0m`},
+		{"del\x7f nul\x00", EscapeControl, `del\x7f nul\x00`},
+		{"csi\u009b ls\u2028 rlo\u202e", EscapeControl, `csi\u009b ls\u2028 rlo\u202e`},
+		{"bad\xff", EscapeControl, `bad\xff`},
+		{"tag\U000e0041", EscapeControl, `tag\U000e0041`},
+	} {
+		if got := string(appendEscaped(nil, c.s, c.mode)); got != c.want {
+			t.Errorf("appendEscaped(%q, %d) = %q, want %q", c.s, c.mode, got, c.want)
+		}
+	}
+
+	//field values with non-printable characters are quoted, keys are escaped
+	fields := []Field{F("k\n", "v\u2028"), F("ok", "中文"), F("a=b c", 1)}
+	if got, want := string(appendFields(nil, fields)), ` k\n="v\u2028" ok=中文 a\x3db\x20c=1`; got != want {
+		t.Errorf("appendFields = %q, want %q", got, want)
+	}
+
+	//forged entry stays in one line
+	file := tempFile(t, "escape.log")
+	logger := New(NewConfig().SetFile(file).SetEscape(EscapeControl))
+	logger.Infof("user %s", "bob\n2022-09-12 23:49:51.553323 1 a.go:1 ERR | forged")
+	logger.Close()
+	if data := readFile(t, file); strings.Count(data, "\n") != 1 || !strings.Contains(data, `INF | user bob\n2022-09-12`) {
+		t.Errorf("unexpected output: %q", data)
+	}
+
+	//sinks
+	e := &Entry{Level: LevelInfo, Message: "bob\nforged"}
+	for _, enc := range []Encoder{TextEncoder, NewTextEncoder(TimeUnix, nil), NewConsoleEncoder(TimeDefault, nil)} {
+		if data := string(EscapeEncoder(enc, EscapeControl).Encode(nil, e)); strings.Count(data, "\n") != 1 || !strings.Contains(data, `bob\nforged`) {
+			t.Errorf("unexpected sink output: %q", data)
+		}
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	for _, c := range []struct {
+		msg  string
+		max  int
+		want string
+	} {
+		{"0123456789", 4, "0123...[truncated 6 bytes]"},
+		{"ab中文", 4, "ab...[truncated 6 bytes]"},  //not in a rune
+		{"ab中文", 5, "ab中...[truncated 3 bytes]"},
+	} {
+		if got := string(appendTruncated(nil, c.msg, c.max)); got != c.want {
+			t.Errorf("appendTruncated(%q, %d) = %q, want %q", c.msg, c.max, got, c.want)
+		}
+	}
+
+	//entries are kept whole across rotated files
+	file := tempFile(t, "max.log")
+	logger := New(NewConfig().
+		SetFile(file).
+		SetSize(250).
+		SetMaxMessageSize(20))
+	long := strings.Repeat("x", 1000)
+	for i := 0; i < 5; i++ {
+		logger.Info(long)
+		logger.Infof("%d %s", i, long)
+	}
+	logger.Close()
+
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(file), "*.log"))
+	lines := 0
+	for _, f := range files {
+		data := readFile(t, f)
+		if !strings.HasSuffix(data, "\n") {
+			t.Errorf("%s: cut entry: %q", f, data)
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+			lines++
+			if !strings.HasSuffix(line, " | " + long[:20] + "...[truncated 980 bytes]") && !strings.HasSuffix(line, long[:18] + "...[truncated 982 bytes]") {
+				t.Errorf("%s: unexpected line: %q", f, line)
+			}
+		}
+	}
+	if len(files) < 2 || lines != 10 {
+		t.Errorf("%d lines in %d files", lines, len(files))
+	}
+}
+
+func TestRotateMultiLine(t *testing.T) {
+	//stack traces and raw newlines stay with their entry
+	file := tempFile(t, "multi.log")
+	logger := New(NewConfig().
+		SetFile(file).
+		SetCaller(true).
+		SetSize(400).
+		SetStacktraceLevel(LevelError))
+	sink := NewFileSink(strings.TrimSuffix(file, ".log") + "_sink.txt").SetSize(40)
+	logger.config.AddSink(sink)
+	for i := 0; i < 6; i++ {
+		logger.Errorf("line %d\ncontinued", i)
+	}
+	logger.Close()
+
+	for _, pattern := range []string{"*.log", "*.txt"} {
+		files, _ := filepath.Glob(filepath.Join(filepath.Dir(file), pattern))
+		entries := 0
+		for _, f := range files {
+			data := readFile(t, f)
+			if len(data) != 0 && (!strings.HasPrefix(data, "20") || !strings.HasSuffix(data, "\n")) {
+				t.Errorf("%s: cut entry: %q", f, data)
+			}
+			entries += strings.Count(data, " ERR | line ")
+		}
+		if len(files) < 2 || entries != 6 {
+			t.Errorf("%s: %d entries in %d files", pattern, entries, len(files))
+		}
+	}
+}
+
+func TestTimeFormat(t *testing.T) {
+	now := time.Date(2022, 9, 2, 3, 4, 5, 123456789, time.FixedZone("CST", 8 * 3600))
+	west := now.In(time.FixedZone("NST", -(3 * 3600 + 30 * 60)))
+	for _, c := range []struct {
+		t      time.Time
+		format TimeFormat
+		want   string
+	} {
+		{now, TimeDefault, "2022-09-02 03:04:05.123456"},
+		{now, TimeMilli, "2022-09-02 03:04:05.123"},
+		{now, TimeNano, "2022-09-02 03:04:05.123456789"},
+		{now, TimeRFC3339, "2022-09-02T03:04:05.123456+08:00"},
+		{now, TimeRFC3339Milli, "2022-09-02T03:04:05.123+08:00"},
+		{now.UTC(), TimeRFC3339Nano, "2022-09-01T19:04:05.123456789Z"},
+		{west, TimeRFC3339, "2022-09-01T15:34:05.123456-03:30"},
+		{now, TimeUnix, "1662059045"},
+		{now, TimeUnixMilli, "1662059045123"},
+	} {
+		if got := string(appendTime(nil, c.t, c.format)); got != c.want {
+			t.Errorf("format %d: got %s want %s", c.format, got, c.want)
+		}
+	}
+
+	//allocation free
+	buf := make([]byte, 0, 64)
+	for format := TimeDefault; format <= TimeUnixMilli; format++ {
+		if n := testing.AllocsPerRun(100, func() { appendTime(buf[:0], now.In(time.UTC), format) }); n != 0 {
+			t.Errorf("format %d: %v allocs", format, n)
+		}
+	}
+
+	//config
+	file := tempFile(t, "time.log")
+	logger := New(NewConfig().
+		SetFile(file).
+		SetClock(fixedClock{now}).
+		SetTimeZone(time.UTC).
+		SetTimeFormat(TimeRFC3339Milli))
+	logger.Info("utc")
+	logger.Close()
+	if data := readFile(t, file); !strings.HasPrefix(data, "2022-09-01T19:04:05.123Z ") {
+		t.Errorf("unexpected output: %s", data)
+	}
+
+	//json
+	e := &Entry{Time: now, Level: LevelInfo, Message: "utc"}
+	if data := string(NewJSONEncoder(time.UTC).Encode(nil, e)); !strings.HasPrefix(data, `{"time":"2022-09-01T19:04:05.123456Z"`) {
+		t.Errorf("unexpected json: %s", data)
+	}
+	if data := string(JSONEncoder.Encode(nil, e)); !strings.HasPrefix(data, `{"time":"2022-09-02T03:04:05.123456+08:00"`) {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
+
+func TestClockConfig(t *testing.T) {
+	now := time.Date(2022, 9, 2, 3, 4, 5, 0, time.Local)
+
+	//zero config falls back to defaults
+	var out bytes.Buffer
+	logger := New(new(Config).SetCaller(true).AddSink(NewWriterSink(&out)))
+	logger.Info("zero")
+	logger.Close()
+	if data := out.String(); !strings.HasSuffix(data, " INF | zero\n") || strings.Count(data, "\n") != 1 || !strings.Contains(data, "/log_test.go:") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	//non-comparable clock changed at runtime
+	config := NewConfig()
+	logger = New(config)
+	config.SetClock(sliceClock{fixedClock{now}, nil})
+	time.Sleep(2 * flushTimeMin)
+	config.SetClock(sliceClock{fixedClock{now}, nil})
+	time.Sleep(2 * flushTimeMin)
+	logger.Close()
+
+	//rotated names of file sink
+	file := tempFile(t, "sink.log")
+	sink := NewFileSink(file).SetSize(10).SetClock(fixedClock{now})
+	sink.Write(&Entry{Time: now, Message: "first"})
+	sink.Write(&Entry{Time: now, Message: "second"})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(file, ".log") + "_2022-09-02_03-04-05_000000000.log"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	now := time.Date(2022, 9, 2, 3, 4, 5, 123456789, time.Local)
+	e := &Entry{Time: now, Level: LevelWarn, Pid: 99, File: "a/b.go", Line: 7, Message: "msg", Fields: []Field{F("k", "v"), F("n", 1)}}
+
+	//compiled default is the same as appendHeader
+	enc := textEncoder{}
+	want := string(enc.Encode(nil, e))
+	enc.layout = compileLayout(DefaultLayout)
+	if got := string(enc.Encode(nil, e)); got != want {
+		t.Errorf("default layout: got %q want %q", got, want)
+	}
+
+	host, _ := os.Hostname()
+	enc = textEncoder{format: TimeMilli, name: "api"}
+	for _, c := range []struct {
+		layout string
+		want   string
+	} {
+		{"{time} {level} [{name}] {caller} {msg}", "2022-09-02 03:04:05.123 WAR [api] a/b.go:7 msg k=v n=1\n"},
+		{"{level}|{file}|{line}|{msg}|{fields}", "WAR|a/b.go|7|msg|k=v n=1\n"},
+		{"{host} {pid}: {msg} {unknown} {", host + " 99: msg k=v n=1 {unknown} {\n"},
+		{"{msg}", "msg k=v n=1\n"},
+	} {
+		enc.layout = compileLayout(c.layout)
+		if got := string(enc.Encode(nil, e)); got != c.want {
+			t.Errorf("layout %q: got %q want %q", c.layout, got, c.want)
+		}
+	}
+
+	//config
+	file := tempFile(t, "layout.log")
+	config := NewConfig().
+		SetFile(file).
+		SetCaller(true).
+		SetName("api").
+		SetLayout("{level} [{name}] {caller} {msg}")
+	logger := New(config)
+	logger.Info("first")
+	config.SetLayout("")
+	logger.Info("second")
+	logger.Close()
+
+	data := readFile(t, file)
+	if !strings.HasPrefix(data, "INF [api] ") || !strings.Contains(data, "/log_test.go:") || !strings.Contains(data, " INF | second\n") {
+		t.Errorf("unexpected output:\n%s", data)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	file := tempFile(t, "caller.log")
+	config := NewConfig().
+		SetFile(file).
+		SetCaller(true)
+	logger := New(config)
+
+	logger.Info("default")
+	config.SetCallerDepth(1)
+	logger.Info("basename")
+	config.SetCallerDepth(CallerModule)
+	logger.Info("module")
+	config.SetCallerDepth(CallerFull).SetCallerFunc(true)
+	logger.Info("full")
+	func() {
+		config.SetCallerDepth(1)
+		logger.Info("closure")
+	}()
+	logger.Close()
+
+	_, self, _, _ := runtime.Caller(0)
+	_, dir := reverseSplitN(self, 2, '/')
+	data := readFile(t, file)
+	for _, want := range []string{
+		" " + dir + ":",
+		" log_test.go:",
+		" log_test.go:",
+		" " + self + ":",
+		" purelog.TestCaller INF | full\n",
+		" log_test.go:",
+		" purelog.TestCaller.func1 INF | closure\n",
+	} {
+		idx := strings.Index(data, want)
+		if idx == -1 {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+		data = data[idx + len(want):]
+	}
+}
+
+func TestSplitFunction(t *testing.T) {
+	for _, c := range []struct {
+		function, file string
+		short, modFile string
+	} {
+		{"github.com/pure-project/purelog.(*Logger).Info", "/src/purelog/logger.go", "purelog.(*Logger).Info", "logger.go"},
+		{"github.com/pure-project/purelog/parse.Open", "/src/purelog/parse/files.go", "parse.Open", "parse/files.go"},
+		{"example.org/x/y.F[...]", "/src/y/f.go", "y.F[...]", "example.org/x/y/f.go"},
+		{"main.main.func1", "/src/app/main.go", "main.main.func1", "main.go"},
+	} {
+		short, modFile := splitFunction(c.function, c.file)
+		if short != c.short || modFile != c.modFile {
+			t.Errorf("split %s: got %s, %s", c.function, short, modFile)
+		}
+	}
+
+	//package main relative to main module
+	loadModules()
+	main, paths := modules.main, modules.paths
+	modules.main, modules.paths = "example.org/app/cmd/tool", []string{"example.org/app"}
+	short, modFile := splitFunction("main.main", "/src/app/cmd/tool/main.go")
+	modules.main, modules.paths = main, paths
+	if short != "main.main" || modFile != "cmd/tool/main.go" {
+		t.Errorf("split main.main: got %s, %s", short, modFile)
+	}
+
+	//cached by pc
+	var infos []*callerInfo
+	for i := 0; i < 2; i++ {
+		infos = append(infos, callerOf(0))
+	}
+	if infos[0] != infos[1] || infos[0].function != "purelog.TestSplitFunction" {
+		t.Errorf("caller not cached: %+v %+v", infos[0], infos[1])
+	}
+}
+
+func TestStacktrace(t *testing.T) {
+	file := tempFile(t, "stack.log")
+	var out bytes.Buffer
+	logger := New(NewConfig().
+		SetFile(file).
+		SetCaller(true).
+		SetStacktraceLevel(LevelError).
+		AddSink(NewWriterSink(&out).SetEncoder(JSONEncoder)))
+
+	logger.Warn("no stack")
+	func() {
+		logger.Errorf("failed %d", 1)
+	}()
+	logger.Close()
+
+	data := readFile(t, file)
+	lines := strings.Split(data, "\n")
+	if !strings.HasSuffix(lines[0], "WAR | no stack") || !strings.HasSuffix(lines[1], "ERR | failed 1") {
+		t.Fatalf("unexpected output:\n%s", data)
+	}
+	//closure, then test function, purelog frames skipped
+	if !strings.HasSuffix(lines[2], "purelog.TestStacktrace.func1") || !strings.HasPrefix(lines[3], "\t") || !strings.Contains(lines[3], "log_test.go:") ||
+		!strings.HasSuffix(lines[4], "purelog.TestStacktrace") || strings.Contains(data, "(*Logger)") {
+		t.Errorf("unexpected stack:\n%s", data)
+	}
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 || entries[0]["stack"] != nil {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if stack, _ := entries[1]["stack"].(string); !strings.HasPrefix(stack, "github.com/pure-project/purelog.TestStacktrace.func1\n\t") {
+		t.Errorf("unexpected stack: %q", stack)
+	}
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	file := tempFile(t, "panic.log")
+	config := NewConfig().
+		SetFile(file).
+		SetCaller(true).
+		SetCallerDepth(1).
+		SetFlush(time.Hour)
+	logger := New(config)
+	defer logger.Close()
+
+	//re-panic by default, logged and flushed before
+	var line int
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("unexpected recover: %v", r)
+			}
+		}()
+		defer logger.RecoverAndLog()
+		_, _, line, _ = runtime.Caller(0)
+		panic("boom")
+	}()
+
+	data := readFile(t, file)
+	if !strings.Contains(data, " log_test.go:" + strconv.Itoa(line + 1) + " ERR | panic: boom\n") {
+		t.Fatalf("unexpected output:\n%s", data)
+	}
+	if !strings.Contains(data, "\ngithub.com/pure-project/purelog.TestRecoverAndLog.func1\n\t") || strings.Contains(data, "(*Logger)") || strings.Contains(data, "runtime.gopanic") {
+		t.Errorf("unexpected stack:\n%s", data)
+	}
+
+	//continue, runtime error in goroutine, flushed by the time sink is
+	sink := &syncSink{flushed: make(chan struct{}, 1)}
+	config.SetPanicContinue(true).AddSink(sink)
+	logger.Go(func() {
+		var m map[string]int
+		m["a"] = 1
+	})
+	select {
+	case <-sink.flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic not flushed")
+	}
+	data = readFile(t, file)
+	if !strings.Contains(data, " ERR | panic: assignment to entry in nil map\n") || strings.Contains(data, "runtime.mapassign") {
+		t.Errorf("unexpected output:\n%s", data)
+	}
+}
+
+//sink signaling flushes of written entries
+type syncSink struct {
+	mtx     sync.Mutex
+	written bool
+	flushed chan struct{}
+}
+
+func (s *syncSink) Level() Level {
+	return LevelDebug
+}
+
+func (s *syncSink) Write(e *Entry) {
+	s.mtx.Lock()
+	s.written = true
+	s.mtx.Unlock()
+}
+
+func (s *syncSink) Flush() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.written {
+		s.written = false
+		select {
+		case s.flushed <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *syncSink) Close() error {
+	return nil
+}
+
+//clock always returning t
+type fixedClock struct {
+	t time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.t
+}
+
+func (c fixedClock) NewTimer(d time.Duration) Timer {
+	return SystemClock.NewTimer(d)
+}
+
+//clock of non-comparable type
+type sliceClock struct {
+	fixedClock
+	pad []int
+}
+
 //benchmarks:
 
 
@@ -367,6 +1071,23 @@ func BenchmarkMulti(b *testing.B) {
 
 //utils:
 
+func tempFile(t *testing.T, name string) string {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, name)
+}
+
+func readFile(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
 func TestReverseSplitN(t *testing.T) {
 	t.Log(reverseSplitN("",           2, '/'))
 	t.Log(reverseSplitN("a.go",       2, '/'))
@@ -381,7 +1102,7 @@ func TestReverseSplitN(t *testing.T) {
 }
 
 func TestAppendHeader(t *testing.T) {
-	t.Logf("%s\n", appendHeader(nil, time.Now(), 99, "test.go", 666, "ERR"))
+	t.Logf("%s\n", appendHeader(nil, time.Now(), TimeDefault, 99, "test.go", 666, "", "ERR"))
 }
 
 func TestAppendInt(t *testing.T) {
@@ -389,6 +1110,27 @@ func TestAppendInt(t *testing.T) {
 	t.Logf("%s\n", appendInt0(nil, 1234, 9))
 }
 
+func TestAppendInt0(t *testing.T) {
+	for _, c := range []struct {
+		num, count int
+		want       string
+	} {
+		{0, 2, "00"}, {7, 2, "07"}, {15, 2, "15"}, {59, 2, "59"},
+		{0, 6, "000000"}, {15, 6, "000015"}, {123456, 6, "123456"},
+		{2022, 4, "2022"}, {7, 9, "000000007"},
+	} {
+		if got := string(appendInt0(nil, c.num, c.count)); got != c.want {
+			t.Errorf("appendInt0(%d, %d) = %s, want %s", c.num, c.count, got, c.want)
+		}
+	}
+
+	//fixed width
+	now := time.Date(2022, 9, 2, 3, 4, 5, 15000, time.Local)
+	if got := string(appendTimestamp(nil, now)); got != "2022-09-02 03:04:05.000015" {
+		t.Errorf("appendTimestamp = %s", got)
+	}
+}
+
 func BenchmarkStdAppendInt(b *testing.B) {
 	var arr [32]byte
 	b.ResetTimer()
@@ -1,12 +1,14 @@
 package purelog
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
-	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -17,10 +19,19 @@ type Logger struct {
 	mtx      sync.Mutex
 	wg       sync.WaitGroup
 	bp       sync.Pool
-	buf      *buffer
+	buf      *buffer  //file output
 	buf2     *buffer
-	files    []string
+	ends     []int   //end offsets of entries in buf, rotation cuts only there
+	ends2    []int   //end offsets of entries in buf2
+	con      *buffer  //stdout output
+	con2     *buffer
+	errs     []span  //lines of con routed to stderr
+	errs2    []span  //lines of con2 routed to stderr
+	tty      bool    //stdout accepts colors
+	fw       fileWriter
 	flushCh  chan bool
+	fmtx     sync.Mutex  //serialize flush of flush goroutine and Sync
+	closed   uint32
 	once     sync.Once
 }
 
@@ -36,7 +47,15 @@ func (l *Logger) Close() {
 	l.once.Do(func() {
 		close(l.flushCh)
 		l.wg.Wait()
-		l.flush()
+		l.fmtx.Lock()
+		defer l.fmtx.Unlock()
+		atomic.StoreUint32(&l.closed, 1)
+		l.flushLocked()
+		for _, sink := range l.config.getSinks() {
+			if err := sink.Close(); err != nil {
+				l.internalError("logger.close: close sink err: %v", err)
+			}
+		}
 	})
 }
 
@@ -45,46 +64,95 @@ func (l *Logger) Flush() {
 	l.flushCh <- true
 }
 
+//flush all outputs and return when written, e.g. before exit
+func (l *Logger) Sync() {
+	l.flush()
+}
+
 func (l *Logger) Debug(args ...interface{}) {
-	l.log(LevelDebug, 1, "", args...)
+	l.log(nil, LevelDebug, 1, "", args)
 }
 
 func (l *Logger) Info(args ...interface{}) {
-	l.log(LevelInfo, 1, "", args...)
+	l.log(nil, LevelInfo, 1, "", args)
 }
 
 func (l *Logger) Warn(args ...interface{}) {
-	l.log(LevelWarn, 1, "", args...)
+	l.log(nil, LevelWarn, 1, "", args)
 }
 
 func (l *Logger) Error(args ...interface{}) {
-	l.log(LevelError, 1, "", args...)
+	l.log(nil, LevelError, 1, "", args)
 }
 
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	l.log(LevelDebug, 1, format, args...)
+	l.log(nil, LevelDebug, 1, format, args)
 }
 
 func (l *Logger) Infof(format string, args ...interface{}) {
-	l.log(LevelInfo, 1, format, args...)
+	l.log(nil, LevelInfo, 1, format, args)
 }
 
 func (l *Logger) Warnf(format string, args ...interface{}) {
-	l.log(LevelWarn, 1, format, args...)
+	l.log(nil, LevelWarn, 1, format, args)
 }
 
 func (l *Logger) Errorf(format string, args ...interface{}) {
-	l.log(LevelError, 1, format, args...)
+	l.log(nil, LevelError, 1, format, args)
 }
 
 func (l *Logger) Log(level Level, skip int, args ...interface{}) {
 	skip++
-	l.log(level, skip, "", args...)
+	l.log(nil, level, skip, "", args)
 }
 
 func (l *Logger) Logf(level Level, skip int, format string, args ...interface{}) {
 	skip++
-	l.log(level, skip, format, args...)
+	l.log(nil, level, skip, format, args)
+}
+
+//context-aware logging: fields bound to ctx by NewContext are appended to the entry
+
+func (l *Logger) DebugCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, LevelDebug, 1, "", args)
+}
+
+func (l *Logger) InfoCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, LevelInfo, 1, "", args)
+}
+
+func (l *Logger) WarnCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, LevelWarn, 1, "", args)
+}
+
+func (l *Logger) ErrorCtx(ctx context.Context, args ...interface{}) {
+	l.log(ctx, LevelError, 1, "", args)
+}
+
+func (l *Logger) DebugfCtx(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, LevelDebug, 1, format, args)
+}
+
+func (l *Logger) InfofCtx(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, LevelInfo, 1, format, args)
+}
+
+func (l *Logger) WarnfCtx(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, LevelWarn, 1, format, args)
+}
+
+func (l *Logger) ErrorfCtx(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, LevelError, 1, format, args)
+}
+
+func (l *Logger) LogCtx(ctx context.Context, level Level, skip int, args ...interface{}) {
+	skip++
+	l.log(ctx, level, skip, "", args)
+}
+
+func (l *Logger) LogfCtx(ctx context.Context, level Level, skip int, format string, args ...interface{}) {
+	skip++
+	l.log(ctx, level, skip, format, args)
 }
 
 
@@ -101,70 +169,169 @@ func (l *Logger) init(config *Config) {
 	l.bp.New  = func() interface{} { return &buffer{ Data: make([]byte, 0, lineBufSize) } }
 	l.buf     = &buffer{ Data: make([]byte, 0, fileBufSizeMin) }
 	l.buf2    = &buffer{ Data: make([]byte, 0, fileBufSizeMin) }
+	l.con     = &buffer{}
+	l.con2    = &buffer{}
+	l.tty     = colorTerminal()
 	l.flushCh = make(chan bool, 1)
 	l.wg.Add(1)
 	go l.doLog()
 }
 
+//entry is recorded if main output or any sink accepts level,
+//e.g. a debug ring sink records entries below main output level
 func (l *Logger) enabled(level Level) bool {
+	if l.outputEnabled(level) {
+		return true
+	}
+	for _, sink := range l.config.getSinks() {
+		if sink.Level() <= level {
+			return true
+		}
+	}
+	return false
+}
+
+//stdout or file output enabled
+func (l *Logger) outputEnabled(level Level) bool {
 	return l.config.getLevel() <= level && (l.config.getStdout() || len(l.config.getFile()) != 0)
 }
 
-func (l *Logger) log(level Level, skip int, format string, args ...interface{}) {
+func (l *Logger) log(ctx context.Context, level Level, skip int, format string, args []interface{}) {
 	if !l.enabled(level) {
 		return
 	}
 
 	skip++
-	file, line := l.caller(skip)
-	_, file = reverseSplitN(file, 2, '/')
+	file, line, function := l.caller(skip)
 
-	levelStr := level.shortString()
+	stack := ""
+	if l.config.getStacktraceLevel() <= level {
+		stack = stackOf(skip)
+	}
 
-	if len(args) == 0 {
-		l.mtx.Lock()
-		defer l.mtx.Unlock()
-		l.buf.Data = appendHeader(l.buf.Data, time.Now(), l.pid, file, line, levelStr)  //for normal time line
-		l.buf.Data = append(l.buf.Data, format...)
-		l.buf.Data = append(l.buf.Data, '\n')
-		return
+	e := Entry{
+		Level:    level,
+		File:     file,
+		Line:     line,
+		Function: function,
+		Stack:    stack,
 	}
+	l.output(ctx, &e, format, args)
+}
+
+//fill pid, message, fields and time of e, then write it to outputs
+func (l *Logger) output(ctx context.Context, e *Entry, format string, args []interface{}) {
+	level := e.Level
+	fields := l.contextFields(ctx)
+
+	msg := format
+	var buf *buffer
+	if len(args) != 0 {
+		str, ok := "", false
+		if len(format) == 0 && len(args) == 1 {
+			str, ok = args[0].(string)
+		}
 
-	if len(format) == 0 && len(args) == 1 {
-		str, ok := args[0].(string)
 		if ok {
-			l.mtx.Lock()
-			defer l.mtx.Unlock()
-			l.buf.Data = appendHeader(l.buf.Data, time.Now(), l.pid, file, line, levelStr)
-			l.buf.Data = append(l.buf.Data, str...)
-			l.buf.Data = append(l.buf.Data, '\n')
-			return
+			msg = str
+		} else {
+			buf = l.bp.Get().(*buffer)
+			defer l.bp.Put(buf)
+
+			buf.Reset()
+			if len(format) == 0 {
+				fmt.Fprint(buf, args...)
+			} else {
+				fmt.Fprintf(buf, format, args...)
+			}
+			msg = b2s(buf.Data)
 		}
 	}
 
-	buf := l.bp.Get().(*buffer)
-	defer l.bp.Put(buf)
-
-	buf.Reset()
-	if len(format) == 0 {
-		fmt.Fprint(buf, args...)
-	} else {
-		fmt.Fprintf(buf, format, args...)
+	//bound message before it is copied to outputs
+	if max := l.config.getMaxMessageSize(); max != 0 && uint64(len(msg)) > max {
+		if buf == nil {
+			buf = l.bp.Get().(*buffer)
+			defer l.bp.Put(buf)
+		}
+		//msg may be in buf, kept part is copied onto itself
+		buf.Data = appendTruncated(buf.Data[:0], msg, int(max))
+		msg = b2s(buf.Data)
 	}
 
-	buf.Data = append(buf.Data, '\n')
+	e.Pid = l.pid
+	e.Message = msg
+	e.Fields = fields
 
 	l.mtx.Lock()
 	defer l.mtx.Unlock()
-	l.buf.Data = appendHeader(l.buf.Data, time.Now(), l.pid, file, line, levelStr)
-	l.buf.Data = append(l.buf.Data, buf.Data...)
+	e.Time = l.config.getClock().Now()  //under lock, keep entries in time order
+	if l.outputEnabled(level) {
+		enc := textEncoder{
+			format: l.config.getTimeFormat(),
+			loc:    l.config.getTimeZone(),
+			layout: l.config.getLayout(),
+			name:   l.config.getName(),
+			escape: l.config.getEscape(),
+		}
+		fbeg := -1
+		if len(l.config.getFile()) != 0 {
+			fbeg = len(l.buf.Data)
+			l.buf.Data = enc.Encode(l.buf.Data, e)
+			l.ends = append(l.ends, len(l.buf.Data))
+		}
+		if l.config.getStdout() {
+			beg := len(l.con.Data)
+			switch {
+			case l.colored():
+				console := consoleEncoder{format: enc.format, loc: enc.loc, layout: enc.layout, name: enc.name, escape: enc.escape}
+				l.con.Data = console.Encode(l.con.Data, e)
+			case fbeg != -1:
+				//same bytes as file
+				l.con.Data = append(l.con.Data, l.buf.Data[fbeg:]...)
+			default:
+				l.con.Data = enc.Encode(l.con.Data, e)
+			}
+			if l.config.getStderrLevel() <= level {
+				l.errs = appendSpan(l.errs, beg, len(l.con.Data))
+			}
+		}
+	}
+	for _, sink := range l.config.getSinks() {
+		if sink.Level() <= level {
+			sink.Write(e)
+		}
+	}
+}
+
+//returns fields bound to ctx followed by fields pulled by config's extractor
+func (l *Logger) contextFields(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields := FromContext(ctx)
+	extractor := l.config.getContextExtractor()
+	if extractor == nil {
+		return fields
+	}
+	extra := extractor(ctx)
+	if len(extra) == 0 {
+		return fields
+	}
+	if len(fields) == 0 {
+		return extra
+	}
+	merged := make([]Field, 0, len(fields) + len(extra))
+	merged = append(merged, fields...)
+	return append(merged, extra...)
 }
 
 func (l *Logger) doLog() {
 	defer l.wg.Done()
 
-	timer := time.NewTimer(maxDuration(flushTimeMin, l.config.getFlush()))
-	defer timer.Stop()
+	holder := l.config.getClockHolder()
+	timer := holder.NewTimer(maxDuration(flushTimeMin, l.config.getFlush()))
+	defer func() { timer.Stop() }()
 
 	for {
 		select {
@@ -174,150 +341,129 @@ func (l *Logger) doLog() {
 			}
 			l.flush()
 
-		case <-timer.C:
+		case <-timer.C():
 			l.flush()
 		}
 
-		timer.Reset(maxDuration(flushTimeMin, l.config.getFlush()))
+		interval := maxDuration(flushTimeMin, l.config.getFlush())
+		if h := l.config.getClockHolder(); h != holder {
+			//clock changed
+			timer.Stop()
+			holder = h
+			timer = holder.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
 	}
 }
 
 //flush log data
 func (l *Logger) flush() {
-	//swap double buffer
-	l.mtx.Lock()
-	l.buf, l.buf2 = l.buf2, l.buf
-	l.mtx.Unlock()
-
-	bufSize := l.buf2.Len()
-	defer l.recycleMemory(bufSize, l.buf2.Cap())
-	if bufSize == 0 {
-		return
+	l.fmtx.Lock()
+	defer l.fmtx.Unlock()
+	if atomic.LoadUint32(&l.closed) == 0 {
+		l.flushLocked()
 	}
+}
 
-	//output stdout
-	if l.config.getStdout() {
-		os.Stdout.Write(l.buf2.Data)
-	}
+func (l *Logger) flushLocked() {
+	l.flushOutput()
 
+	//flush sinks
 	file := l.config.getFile()
-	if len(file) == 0 {
-		return
+	for _, sink := range l.config.getSinks() {
+		if s, ok := sink.(logFileSink); ok {
+			s.setLogFile(file)
+		}
+		if err := sink.Flush(); err != nil {
+			l.internalError("logger.flush: flush sink err: %v", err)
+		}
 	}
+}
 
-	data := l.buf2.Data
-
-	//rotate
-	size := l.config.getSize()
-	if size != 0 {
-		data = l.rotate(size, file, data)
-	}
+//flush stdout and file output
+func (l *Logger) flushOutput() {
+	//swap double buffer
+	l.mtx.Lock()
+	l.buf, l.buf2 = l.buf2, l.buf
+	l.con, l.con2 = l.con2, l.con
+	l.errs, l.errs2 = l.errs2, l.errs
+	l.ends, l.ends2 = l.ends2, l.ends
+	l.mtx.Unlock()
 
-	//sync to disk
-	l.sync(file, data)
-}
+	defer func() {
+		recycleBuffer(l.buf2)
+		recycleBuffer(l.con2)
+		l.errs2 = l.errs2[:0]
+		l.ends2 = l.ends2[:0]
+	}()
 
-//sync write data to file
-func (l *Logger) sync(file string, data []byte) {
-	dir, _ := reverseSplitN(file, 1, '/')
-	_ = os.MkdirAll(dir, os.ModePerm)
+	//output stdout (and stderr)
+	if l.con2.Len() != 0 {
+		writeConsole(l.con2.Data, l.errs2)
+	}
 
-	out, err := os.OpenFile(file, os.O_CREATE | os.O_APPEND | os.O_WRONLY | os.O_SYNC, 0666)
-	if err != nil {
-		l.internalError("logger.sync: open log file %s err: %v", file, err)
+	file := l.config.getFile()
+	if len(file) == 0 || l.buf2.Len() == 0 {
 		return
 	}
-	defer out.Close()
 
-	_, err = out.Write(data)
+	//rotate and sync to disk
+	err := l.fw.write(file, l.buf2.Data, l.ends2, l.config.getSize(), l.config.getCount(), l.config.getClock())
 	if err != nil {
-		l.internalError("logger.sync: write log file %s err: %v", file, err)
-		return
+		l.internalError("%v", err)
 	}
-	_ = out.Sync()
 }
 
-func (l *Logger) rotate(size uint64, file string, data []byte) []byte {
-	for len(data) != 0 {
-		fileSz := fileSize(file)
-		if uint64(len(data)) + fileSz >= size {
-			//can write size
-			sz := size - fileSz
-			//adjust line
-			idx := reverseIndexB(data[:sz], 1, '\n')
-			if idx != -1 {
-				l.sync(file, data[:idx])
-				data = data[idx+1:]
-			} else {
-				//adjust fail, direct cut
-				l.sync(file, data[:sz])
-				data = data[sz:]
-			}
-			//do rotate
-			l.rotateFile(file)
-			continue
+//write data to stdout, except spans to stderr
+func writeConsole(data []byte, errs []span) {
+	pos := 0
+	for _, sp := range errs {
+		if pos < sp.beg {
+			os.Stdout.Write(data[pos:sp.beg])
 		}
-
-		break
+		os.Stderr.Write(data[sp.beg:sp.end])
+		pos = sp.end
+	}
+	if pos < len(data) {
+		os.Stdout.Write(data[pos:])
 	}
-	return data
 }
 
-func (l *Logger) rotateFile(file string) {
-	//gen new file name
-	name, ext := reverseSplitN(file, 1, '.')
-	var arr [128]byte
-	buf := append(arr[:0], name...)
-	buf = append(buf, '_')
-	buf = appendRotateTime(buf, time.Now())
-	buf = append(buf, '.')
-	buf = append(buf, ext...)
-	newFile := b2s(buf)
-
-	//move file
-	err := os.Rename(file, newFile)
-	if err != nil {
-		l.internalError("logger.rotate: move file %s to %s err: %v", file, newFile, err)
-		os.Remove(file)
+//recycle memory when most space unused.
+func recycleBuffer(buf *buffer) {
+	if fileBufSizeMax < buf.Cap() && buf.Len() <= fileBufSizeMin {
+		buf.Data = make([]byte, 0, fileBufSizeMin)
 		return
 	}
-
-	//add to files
-	l.files = append(l.files, newFile)
-
-	//clean older
-	l.clean()
+	buf.Reset()
 }
 
-func (l *Logger) clean() {
-	count := l.config.getCount()
-	if count != 0 && uint32(len(l.files)) >= count {
-		file := l.files[0]
-		err := os.Remove(file)
-		if err != nil {
-			l.internalError("logger.clean: remove log file %s err: %v", file, err)
-		}
-		l.files = l.files[1:]
+//stdout output colored
+func (l *Logger) colored() bool {
+	switch l.config.getColor() {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
 	}
+	return l.tty
 }
 
-func (l *Logger) recycleMemory(size, cap int) {
-	//recycle memory when most space unused.
-	if fileBufSizeMax < cap && size <= fileBufSizeMin {
-		//l.Debugf("recycle memory: size=%d cap=%d", size, cap)   //output memory recycle logging if need
-		l.buf2.Data = make([]byte, 0, fileBufSizeMin)
-		return
+//caller file in configured depth, line, and function if enabled
+func (l *Logger) caller(skip int) (string, int, string) {
+	if !l.config.getCaller() {
+		return "???", 0, ""
 	}
-	l.buf2.Reset()
-}
-
-func (l *Logger) caller(skip int) (string, int) {
-	if l.config.getCaller() {
-		skip++
-		_, file, line, _ := runtime.Caller(skip)
-		return file, line
+	info := callerOf(skip + 1)
+	if info == nil {
+		return "???", 0, ""
 	}
-	return "???", 0
+	function := ""
+	if l.config.getCallerFunc() {
+		function = info.function
+	}
+	return info.path(l.config.getCallerDepth()), info.line, function
 }
 
 func (l *Logger) internalError(format string, args ...interface{}) {
@@ -339,6 +485,21 @@ func (l *Logger) internalError(format string, args ...interface{}) {
 	}
 }
 
+//byte range [beg, end)
+type span struct {
+	beg int
+	end int
+}
+
+//append span, merge with last one if adjacent
+func appendSpan(spans []span, beg, end int) []span {
+	if n := len(spans); n != 0 && spans[n-1].end == beg {
+		spans[n-1].end = end
+		return spans
+	}
+	return append(spans, span{beg: beg, end: end})
+}
+
 //lite byte buffer
 type buffer struct {
 	Data []byte
@@ -375,38 +536,39 @@ func (buf *buffer) Reset() {
 //utils:
 
 //1949-10-01 07:00:00.000000 pid file line level |
-func appendHeader(buf []byte, now time.Time, pid int, file string, line int, level string) []byte {
-	buf = appendTimestamp(buf, now)
+func appendHeader(buf []byte, now time.Time, format TimeFormat, pid int, file string, line int, function string, level string) []byte {
+	buf = appendTime(buf, now, format)
 	buf = append(buf, ' ')
 	buf = appendInt(buf, pid)
 	buf = append(buf, ' ')
 	buf = append(buf, file...)
 	buf = append(buf, ':')
 	buf = appendInt(buf, line)
+	if len(function) != 0 {
+		buf = append(buf, ' ')
+		buf = append(buf, function...)
+	}
 	buf = append(buf, ' ')
 	buf = append(buf, level...)
 	return append(buf, " | "...)
 }
 
+//first max bytes of msg (cut at utf-8 boundary), then ...[truncated N bytes]
+func appendTruncated(buf []byte, msg string, max int) []byte {
+	cut := max
+	for cut > 0 && cut > max - utf8.UTFMax && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	n := len(msg) - cut
+	buf = append(buf, msg[:cut]...)
+	buf = append(buf, "...[truncated "...)
+	buf = appendInt(buf, n)
+	return append(buf, " bytes]"...)
+}
+
 //1949-10-01 07:00:00.000000
 func appendTimestamp(buf []byte, now time.Time) []byte {
-	y, m ,d := now.Date()
-	h, min, s := now.Clock()
-	us := now.Nanosecond() / 1000
-
-	buf = appendInt0(buf, y, 4)
-	buf = append(buf, '-')
-	buf = appendInt0(buf, int(m), 2)
-	buf = append(buf, '-')
-	buf = appendInt0(buf, d, 2)
-	buf = append(buf, ' ')
-	buf = appendInt0(buf, h, 2)
-	buf = append(buf, ':')
-	buf = appendInt0(buf, min, 2)
-	buf = append(buf, ':')
-	buf = appendInt0(buf, s, 2)
-	buf = append(buf, '.')
-	return appendInt0(buf, us, 6)
+	return appendDateTime(buf, now, ' ', 6)
 }
 
 //1949-10-01_07-10-59_000000000
@@ -461,12 +623,7 @@ func appendInt(buf []byte, num int) []byte {
 
 //int to string pad zero
 func appendInt0(buf []byte, num, count int) []byte {
-	if num < 10 {
-		buf  = append(buf, '0')
-		return append(buf, '0' + byte(num))
-	}
-
-	if num < 20 {
+	if count == 2 && num < 100 {
 		buf  = append(buf, '0' + byte(num / 10))
 		return append(buf, '0' + byte(num % 10))
 	}
@@ -481,24 +638,19 @@ func appendInt0(buf []byte, num, count int) []byte {
 		num /= 10
 	}
 
-	//reverse
+	//pad zeros
 	for i := 0; i < count - len(b); i++ {
 		buf = append(buf, '0')
 	}
 
-	//pad zeros
-	for i := minInt(len(b) - 1, count); i >= 0; i-- {
+	//reverse
+	for i := len(b) - 1; i >= 0; i-- {
 		buf = append(buf, b[i])
 	}
 
 	return buf
 }
 
-func minInt(a, b int) int {
-	if a < b { return a }
-	return b
-}
-
 //returns max time.Duration
 func maxDuration(a, b time.Duration) time.Duration {
 	if a < b { return b }
@@ -541,9 +693,11 @@ func b2s(b []byte) string {
 }
 
 //fast string to []byte
-func s2b(s string) []byte {
-	hdr := (*reflect.StringHeader)(unsafe.Pointer(&s))
-	return *(*[]byte)(unsafe.Pointer(&reflect.SliceHeader{Data: hdr.Data, Len: hdr.Len, Cap: hdr.Len}))
+func s2b(s string) (b []byte) {
+	sh := (*reflect.StringHeader)(unsafe.Pointer(&s))
+	bh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	bh.Data, bh.Len, bh.Cap = sh.Data, sh.Len, sh.Len
+	return b
 }
 
 //get file size
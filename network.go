@@ -0,0 +1,346 @@
+package purelog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	netDialTimeout  = time.Second             //dial runs on the flush goroutine, keep it short
+	netBackoffMin   = 100 * time.Millisecond  //first reconnect delay
+	netBackoffMax   = 30 * time.Second        //max reconnect delay
+	netDatagramSize = 8 * 1024                //max udp datagram payload
+	netWriteTimeout = 10 * time.Second        //write deadline of each flush
+	netSpillSize    = 64 * 1024 * 1024        //default max spill file size
+	netReplayChunk  = 256 * 1024              //spill file is replayed in chunks of this size
+)
+
+var errNetBackoff = errors.New("network: waiting to reconnect")
+
+//sink streams encoded lines to a collector over tcp (newline-delimited) or udp
+//
+//while disconnected, data is spilled to a bounded file on disk and replayed on reconnect.
+//the spill file defaults to the logger's file with ".spill" appended, see SetSpill.
+type NetworkSink struct {
+	level      uint32
+	spillSize  uint64
+	encoder    atomic.Value
+	network    string
+	addr       string
+	spillFile  string
+	spillSet   bool  //spill file set by SetSpill
+	backoffMin time.Duration
+	backoffMax time.Duration
+	chunk      int   //replay chunk size
+	db         doubleBuffer
+
+	//used by flush only
+	conn       net.Conn
+	backoff    time.Duration
+	retryAt    time.Time
+	down       bool  //disconnect reported
+	spilled    bool  //spill file may have data
+	checked    bool  //spill file of previous run checked
+}
+
+//new network sink, network is "tcp" or "udp"
+//
+//default level is debug, encoder is TextEncoder and spill file is "<file>.spill"
+//next to the logger's file (none without file) of up to 64MB.
+func NewNetworkSink(network, addr string) *NetworkSink {
+	s := &NetworkSink{
+		network:    network,
+		addr:       addr,
+		spillSize:  netSpillSize,
+		backoffMin: netBackoffMin,
+		backoffMax: netBackoffMax,
+		chunk:      netReplayChunk,
+	}
+	s.encoder.Store(encoderHolder{TextEncoder})
+	s.db.init()
+	return s
+}
+
+func (s *NetworkSink) SetLevel(level Level) *NetworkSink {
+	atomic.StoreUint32(&s.level, uint32(level))
+	return s
+}
+
+func (s *NetworkSink) SetEncoder(encoder Encoder) *NetworkSink {
+	s.encoder.Store(encoderHolder{encoder})
+	return s
+}
+
+//set spill file and its max size (0: 64MB), empty file disables spilling.
+//must be called before logging
+func (s *NetworkSink) SetSpill(file string, size uint) *NetworkSink {
+	if size == 0 {
+		size = netSpillSize
+	}
+	s.spillFile = file
+	s.spillSize = uint64(size)
+	s.spillSet = true
+	return s
+}
+
+//default spill file next to logger's file, called by the logger before Flush
+func (s *NetworkSink) setLogFile(file string) {
+	if !s.spillSet && len(file) != 0 {
+		s.spillFile = file + ".spill"
+		s.spillSet = true
+	}
+}
+
+//set reconnect delay range, the delay doubles on each failure, must be called before logging
+func (s *NetworkSink) SetBackoff(min, max time.Duration) *NetworkSink {
+	s.backoffMin = min
+	s.backoffMax = maxDuration(min, max)
+	return s
+}
+
+func (s *NetworkSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.level))
+}
+
+func (s *NetworkSink) Write(e *Entry) {
+	s.db.write(s.encoder.Load().(encoderHolder).Encoder, e)
+}
+
+func (s *NetworkSink) Flush() error {
+	buf := s.db.swap()
+	defer s.db.recycle()
+
+	if !s.checked {
+		s.checked = true
+		s.spilled = len(s.spillFile) != 0 && fileSize(s.spillFile) != 0
+	}
+	if buf.Len() == 0 && !s.spilled {
+		return nil
+	}
+
+	err := s.connect()
+	if err == nil && s.spilled {
+		err = s.replay()
+	}
+	data := buf.Data
+	if err == nil {
+		data, err = s.write(data)
+	}
+	if err == nil {
+		s.down = false
+		return nil
+	}
+
+	if err != errNetBackoff {
+		s.disconnect()
+	}
+	return s.spill(data, err)
+}
+
+func (s *NetworkSink) Close() error {
+	err := s.Flush()
+
+	s.db.fmtx.Lock()
+	defer s.db.fmtx.Unlock()
+	s.disconnect()
+	return err
+}
+
+//dial if disconnected and backoff elapsed
+func (s *NetworkSink) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Before(s.retryAt) {
+		return errNetBackoff
+	}
+
+	conn, err := net.DialTimeout(s.network, s.addr, netDialTimeout)
+	if err != nil {
+		//exponential backoff
+		s.backoff = maxDuration(s.backoffMin, s.backoff * 2)
+		if s.backoff > s.backoffMax {
+			s.backoff = s.backoffMax
+		}
+		s.retryAt = now.Add(s.backoff)
+		return err
+	}
+
+	s.conn = conn
+	s.backoff = 0
+	return nil
+}
+
+func (s *NetworkSink) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+//write lines, returns unsent data on error
+func (s *NetworkSink) write(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(netWriteTimeout))
+
+	if s.network != "udp" && s.network != "udp4" && s.network != "udp6" {
+		n, err := s.conn.Write(data)
+		if err != nil {
+			//resend from the first partial line
+			return data[lineStart(data, n):], err
+		}
+		return nil, nil
+	}
+
+	//pack whole lines into datagrams
+	for len(data) != 0 {
+		n := len(data)
+		if n > netDatagramSize {
+			n = netDatagramSize
+			if idx := reverseIndexB(data[:n], 1, '\n'); idx != -1 {
+				n = idx + 1
+			}
+		}
+		if _, err := s.conn.Write(data[:n]); err != nil {
+			return data, err
+		}
+		data = data[n:]
+	}
+	return nil, nil
+}
+
+//send spilled data in chunks of whole lines, keep the unsent part on failure
+func (s *NetworkSink) replay() error {
+	file, err := os.Open(s.spillFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.spilled = false
+			return nil
+		}
+		return err
+	}
+
+	buf := make([]byte, s.chunk)
+	sent := int64(0)
+	n := 0
+	for {
+		m, rerr := io.ReadFull(file, buf[n:])
+		n += m
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			file.Close()
+			return rerr
+		}
+
+		end := n
+		if rerr == nil {
+			//more to read, keep partial last line for next chunk
+			if idx := reverseIndexB(buf[:n], 1, '\n'); idx != -1 {
+				end = idx + 1
+			}
+		}
+		rest, err := s.write(buf[:end])
+		sent += int64(end - len(rest))
+		if err != nil {
+			file.Close()
+			if werr := s.trimSpill(sent); werr != nil {
+				return werr
+			}
+			return err
+		}
+		n = copy(buf, buf[end:n])
+		if rerr != nil {
+			break
+		}
+	}
+	file.Close()
+
+	s.spilled = false
+	if err = os.Remove(s.spillFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+//remove first off bytes of spill file
+func (s *NetworkSink) trimSpill(off int64) error {
+	if off == 0 {
+		return nil
+	}
+	in, err := os.Open(s.spillFile)
+	if err != nil {
+		return err
+	}
+	tmp := s.spillFile + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		in.Close()
+		return err
+	}
+
+	_, err = in.Seek(off, io.SeekStart)
+	if err == nil {
+		_, err = io.Copy(out, in)
+	}
+	in.Close()
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.spillFile)
+}
+
+//save unsent data to spill file, report only first failure and overflow
+func (s *NetworkSink) spill(data []byte, cause error) error {
+	var err error
+	if !s.down {
+		s.down = true
+		err = fmt.Errorf("network: send to %s err: %v", s.addr, cause)
+	}
+	if len(data) == 0 || len(s.spillFile) == 0 {
+		return err  //no spill file, data dropped
+	}
+
+	//bounded, drop newest lines over size
+	dropped := 0
+	free := int64(s.spillSize) - int64(fileSize(s.spillFile))
+	if free < int64(len(data)) {
+		keep := 0
+		if free > 0 {
+			keep = reverseIndexB(data[:free], 1, '\n') + 1
+		}
+		dropped = len(data) - keep
+		data = data[:keep]
+	}
+
+	var fw fileWriter
+	if len(data) != 0 {
+		if werr := fw.write(s.spillFile, data, nil, 0, 0, SystemClock); werr != nil {
+			return werr
+		}
+		s.spilled = true
+	}
+	if dropped != 0 {
+		return fmt.Errorf("network: spill file %s full, dropped %d bytes", s.spillFile, dropped)
+	}
+	return err
+}
+
+//returns offset of the line containing data[pos]
+func lineStart(data []byte, pos int) int {
+	if pos >= len(data) {
+		return len(data)
+	}
+	return reverseIndexB(data[:pos], 1, '\n') + 1
+}
@@ -0,0 +1,40 @@
+package purelog
+
+//log a recovered panic at error level with its stack, flush synchronously, then
+//re-panic unless Config.SetPanicContinue. must be deferred directly:
+//
+//	defer logger.RecoverAndLog()
+func (l *Logger) RecoverAndLog() {
+	if r := recover(); r != nil {
+		l.logPanic(r)
+	}
+}
+
+//run fn in a new goroutine, recovering its panic by RecoverAndLog
+func (l *Logger) Go(fn func()) {
+	go func() {
+		defer l.RecoverAndLog()
+		fn()
+	}()
+}
+
+func (l *Logger) logPanic(r interface{}) {
+	if l.enabled(LevelError) {
+		//skip logPanic and RecoverAndLog
+		info, stack := panicStackOf(2)
+
+		e := Entry{Level: LevelError, File: "???", Stack: stack}
+		if info != nil && l.config.getCaller() {
+			e.File, e.Line = info.path(l.config.getCallerDepth()), info.line
+			if l.config.getCallerFunc() {
+				e.Function = info.function
+			}
+		}
+		l.output(nil, &e, "panic: %v", []interface{}{r})
+	}
+
+	l.Sync()
+	if !l.config.getPanicContinue() {
+		panic(r)
+	}
+}
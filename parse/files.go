@@ -0,0 +1,144 @@
+package parse
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//file name time written by rotation: name_1949-10-01_07-10-59_000000000.ext
+const RotateLayout = "2006-01-02_15-04-05"
+
+//file of a rotated set
+type SetFile struct {
+	Name    string
+	Rotated time.Time  //rotation time parsed from name, zero for the active file
+}
+
+//returns rotated files of file (name_YYYY-MM-DD_HH-MM-SS_NS.ext) oldest first,
+//followed by file itself if it exists
+func FileSet(file string) ([]SetFile, error) {
+	name, ext := splitExt(file)
+	matches, err := filepath.Glob(escapeGlob(name) + "_*" + ext)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []SetFile
+	for _, match := range matches {
+		t, ok := ParseRotateTime(match[len(name) + 1 : len(match) - len(ext)])
+		if ok {
+			files = append(files, SetFile{Name: match, Rotated: t})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Rotated.Before(files[j].Rotated)
+	})
+
+	if _, err = os.Stat(file); err == nil {
+		files = append(files, SetFile{Name: file})
+	}
+	return files, nil
+}
+
+//parse 1949-10-01_07-10-59_000000000
+func ParseRotateTime(s string) (time.Time, bool) {
+	if len(s) != len(RotateLayout) + 10 || s[len(RotateLayout)] != '_' {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(RotateLayout, s[:len(RotateLayout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	ns := 0
+	for _, c := range s[len(RotateLayout) + 1:] {
+		if c < '0' || c > '9' {
+			return time.Time{}, false
+		}
+		ns = ns * 10 + int(c - '0')
+	}
+	return t.Add(time.Duration(ns)), true
+}
+
+//open files as one record stream, in order
+func Open(files ...string) (*Reader, error) {
+	opened, err := openFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	return newFilesReader(opened), nil
+}
+
+func openFiles(files []string) ([]*os.File, error) {
+	opened := make([]*os.File, 0, len(files))
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			for _, f := range opened {
+				f.Close()
+			}
+			return nil, err
+		}
+		opened = append(opened, file)
+	}
+	return opened, nil
+}
+
+func newFilesReader(files []*os.File) *Reader {
+	readers := make([]io.Reader, len(files))
+	closers := make([]io.Closer, len(files))
+	for i, file := range files {
+		readers[i], closers[i] = file, file
+	}
+
+	//an entry cut by rotation continues in the next file
+	r := NewReader(io.MultiReader(readers...))
+	r.closers = closers
+	return r
+}
+
+//open rotated set of file in chronological order
+func OpenSet(file string) (*Reader, error) {
+	set, err := setOf(file)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(set))
+	for i := range set {
+		names[i] = set[i].Name
+	}
+	return Open(names...)
+}
+
+//file set, error if empty
+func setOf(file string) ([]SetFile, error) {
+	set, err := FileSet(file)
+	if err == nil && len(set) == 0 {
+		err = &os.PathError{Op: "open", Path: file, Err: os.ErrNotExist}
+	}
+	return set, err
+}
+
+//same split as purelog rotation: "dir/name.ext" => "dir/name", ".ext"
+func splitExt(file string) (string, string) {
+	idx := strings.LastIndexByte(file, '.')
+	if idx == -1 {
+		return file, ""
+	}
+	return file[:idx], file[idx:]
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,295 @@
+package parse
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pure-project/purelog"
+)
+
+const sample = `garbage before first header
+2022-09-12 23:49:51.542323 16180 demo/main.go:10 DBG | debug message.
+2022-09-12 23:49:51.553323 16180 demo/main.go:11 INF | info message. user=bob
+2022-09-12 23:49:52.000001 16181 demo/worker.go:42 WAR | multi
+line | message
+  with indent
+2022-09-12 23:49:53.100000 16181 demo/main.go:13 ERR | error message.
+`
+
+func readAll(t *testing.T, r *Reader) []*Record {
+	var recs []*Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return recs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func TestReader(t *testing.T) {
+	recs := readAll(t, NewReader(strings.NewReader(sample)))
+	if len(recs) != 4 {
+		t.Fatalf("got %d records", len(recs))
+	}
+
+	rec := recs[2]
+	if rec.Pid != 16181 || rec.File != "demo/worker.go" || rec.Line != 42 || rec.Level != purelog.LevelWarn {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+	if rec.Message != "multi\nline | message\n  with indent" {
+		t.Errorf("unexpected message: %q", rec.Message)
+	}
+	if !strings.HasPrefix(rec.Raw, "2022-09-12 23:49:52.000001 16181") || !strings.HasSuffix(rec.Raw, "\n  with indent") {
+		t.Errorf("unexpected raw: %q", rec.Raw)
+	}
+	if want := time.Date(2022, 9, 12, 23, 49, 52, 1000, time.Local); !rec.Time.Equal(want) {
+		t.Errorf("unexpected time: %v", rec.Time)
+	}
+	if recs[3].Message != "error message." {
+		t.Errorf("unexpected message: %q", recs[3].Message)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"2022-09-12 23:49:51.542323",
+		"2022-09-12 23:49:51.542323 x demo/main.go:10 DBG | msg",
+		"2022-09-12 23:49:51.542323 1 demo/main.go:10 XXX | msg",
+		"2022-09-12 23:49:51.542323 1 demo/main.go DBG | msg",
+		"2022-13-12 23:49:51.542323 1 demo/main.go:10 DBG | msg",
+	} {
+		if _, ok := ParseHeader(line); ok {
+			t.Errorf("parsed %q", line)
+		}
+	}
+
+	rec, ok := ParseHeader("2022-09-12 23:49:51.542323 1 c:/demo/main.go:10 ERR | a | b")
+	if !ok || rec.File != "c:/demo/main.go" || rec.Line != 10 || rec.Level != purelog.LevelError || rec.Message != "a | b" {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+
+	rec, ok = ParseHeader("2022-09-12 23:49:51.542323 1 my app/db/conn.go:10 db.(*Conn).Close WAR | msg")
+	if !ok || rec.File != "my app/db/conn.go" || rec.Line != 10 || rec.Func != "db.(*Conn).Close" || rec.Level != purelog.LevelWarn {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "app.log")
+	write := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("app_2022-09-12_23-49-52_000000001.log", " by rotation\n2022-09-12 23:49:51.900000 1 a.go:2 INF | second\n")
+	write("app_2022-09-12_23-49-51_500000000.log", "2022-09-12 23:49:51.000000 1 a.go:1 INF | first\ncut")
+	write("app.log", "2022-09-12 23:49:52.100000 1 a.go:3 INF | third\n")
+	write("app_bad.log", "ignored\n")
+	write("other_2022-09-12_23-49-52_000000001.log", "ignored\n")
+
+	set, err := FileSet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 3 || filepath.Base(set[0].Name) != "app_2022-09-12_23-49-51_500000000.log" || set[2].Name != file || !set[2].Rotated.IsZero() {
+		t.Fatalf("unexpected set: %+v", set)
+	}
+	if want := time.Date(2022, 9, 12, 23, 49, 52, 1, time.Local); !set[1].Rotated.Equal(want) {
+		t.Errorf("unexpected rotate time: %v", set[1].Rotated)
+	}
+
+	r, err := OpenSet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	recs := readAll(t, r)
+	if len(recs) != 3 || recs[0].Message != "first\ncut by rotation" || recs[1].Message != "second" || recs[2].Message != "third" {
+		t.Errorf("unexpected records: %+v", recs)
+	}
+}
+
+//rotated by purelog itself
+func TestOpenSetLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.log")
+
+	logger := purelog.New(purelog.NewConfig().SetFile(file).SetSize(256).SetCount(100))
+	for i := 0; i < 20; i++ {
+		logger.Infof("message %d", i)
+		logger.Flush()
+		time.Sleep(10 * time.Millisecond)
+	}
+	logger.Close()
+
+	set, err := FileSet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set) < 2 {
+		t.Fatalf("not rotated: %+v", set)
+	}
+
+	r, err := OpenSet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	recs := readAll(t, r)
+	if len(recs) != 20 {
+		t.Fatalf("got %d records", len(recs))
+	}
+	for i, rec := range recs {
+		if want := fmt.Sprintf("message %d", i); rec.Message != want {
+			t.Errorf("record %d out of order: %q", i, rec.Message)
+		}
+		if i > 0 && rec.Time.Before(recs[i - 1].Time) {
+			t.Errorf("record %d out of order: %v", i, rec.Time)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	//entries 10ms apart, some with continuation and long lines
+	base := time.Date(2022, 9, 12, 23, 0, 0, 0, time.Local)
+	var b strings.Builder
+	var offs []int64
+	for i := 0; i < 500; i++ {
+		offs = append(offs, int64(b.Len()))
+		ts := base.Add(time.Duration(i) * 10 * time.Millisecond).Format(TimeLayout)
+		fmt.Fprintf(&b, "%s 1 a.go:1 INF | message %d\n", ts, i)
+		switch i % 7 {
+		case 3:
+			b.WriteString("continuation\n2022-09-12 looks like a header\n")
+		case 5:
+			b.WriteString(strings.Repeat("x", 10000) + "\n")
+		}
+	}
+	data := b.String()
+	r := strings.NewReader(data)
+	size := int64(len(data))
+
+	for _, c := range []struct {
+		t    time.Time
+		want int64
+	}{
+		{base.Add(-time.Hour), 0},
+		{base, 0},
+		{base.Add(time.Millisecond), offs[1]},
+		{base.Add(2500 * time.Millisecond), offs[250]},
+		{base.Add(4990 * time.Millisecond), offs[499]},
+		{base.Add(4991 * time.Millisecond), size},
+	} {
+		off, err := Seek(r, size, c.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if off != c.want {
+			t.Errorf("seek %v: got %d want %d", c.t, off, c.want)
+		}
+	}
+
+	//no header
+	if off, err := Seek(strings.NewReader("a\nb\n"), 4, base); err != nil || off != 4 {
+		t.Errorf("seek no header: %d %v", off, err)
+	}
+}
+
+func TestSelectFiles(t *testing.T) {
+	base := time.Date(2022, 9, 12, 23, 0, 0, 0, time.Local)
+	set := []SetFile{
+		{"a_1", base.Add(time.Minute)},
+		{"a_2", base.Add(2 * time.Minute)},
+		{"a_3", base.Add(3 * time.Minute)},
+		{"a", time.Time{}},
+	}
+	names := func(set []SetFile) string {
+		var s []string
+		for _, file := range set {
+			s = append(s, file.Name)
+		}
+		return strings.Join(s, ",")
+	}
+
+	for _, c := range []struct {
+		from, to time.Time
+		want     string
+	}{
+		{time.Time{}, time.Time{}, "a_1,a_2,a_3,a"},
+		{base.Add(90 * time.Second), time.Time{}, "a_2,a_3,a"},
+		{base.Add(2 * time.Minute), time.Time{}, "a_3,a"},
+		{base.Add(5 * time.Minute), time.Time{}, "a"},
+		{time.Time{}, base.Add(30 * time.Second), "a_1,a_2"},
+		{base.Add(70 * time.Second), base.Add(110 * time.Second), "a_2,a_3"},
+		{base.Add(70 * time.Second), base.Add(150 * time.Second), "a_2,a_3,a"},
+		{base.Add(70 * time.Second), base.Add(10 * time.Minute), "a_2,a_3,a"},
+	} {
+		if got := names(SelectFiles(set, c.from, c.to)); got != c.want {
+			t.Errorf("select [%v, %v): got %s want %s", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestOpenSetRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.log")
+
+	//3 files of 100 entries 1s apart, rotated after each
+	base := time.Date(2022, 9, 12, 23, 0, 0, 0, time.Local)
+	names := []string{
+		"app_" + base.Add(100 * time.Second).Format(RotateLayout) + "_000000000.log",
+		"app_" + base.Add(200 * time.Second).Format(RotateLayout) + "_000000000.log",
+		"app.log",
+	}
+	for i, name := range names {
+		var b strings.Builder
+		for j := i * 100; j < i * 100 + 100; j++ {
+			fmt.Fprintf(&b, "%s 1 a.go:1 INF | message %d\n", base.Add(time.Duration(j) * time.Second).Format(TimeLayout), j)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(b.String()), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := OpenSetRange(file, base.Add(150 * time.Second), base.Add(210 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.closers) != 2 {
+		t.Errorf("opened %d files", len(r.closers))
+	}
+	recs := readAll(t, r)
+	if len(recs) != 60 || recs[0].Message != "message 150" || recs[59].Message != "message 209" {
+		t.Errorf("unexpected records: %d %+v", len(recs), recs)
+	}
+
+	if _, err = OpenSetRange(filepath.Join(dir, "none.log"), base, time.Time{}); !os.IsNotExist(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+//Package parse reads entries from text written by purelog's default format.
+//
+//	1949-10-01 07:00:00.000000 pid file:line [function] LVL | message
+//
+//lines not starting with a header are continuation lines of the previous entry.
+package parse
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pure-project/purelog"
+)
+
+//timestamp written by purelog: 1949-10-01 07:00:00.000000
+const TimeLayout = "2006-01-02 15:04:05.000000"
+
+//log entry parsed from text
+type Record struct {
+	Time    time.Time
+	Pid     int
+	File    string
+	Line    int
+	Func    string  //written with Config.SetCallerFunc
+	Level   purelog.Level
+	Message string  //continuation lines joined with '\n'
+	Raw     string  //original text without trailing newline
+}
+
+//streaming record reader
+type Reader struct {
+	r       *bufio.Reader
+	next    *Record  //header already read
+	err     error
+	closers []io.Closer
+	from    time.Time  //skip entries before
+	to      time.Time  //end at first entry at or after
+	done    bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64 * 1024)}
+}
+
+//returns next record, io.EOF at end.
+//lines before the first header (e.g. tail of an entry cut by rotation) are dropped.
+//after io.EOF Read can be called again to read data appended to a growing file.
+func (r *Reader) Read() (*Record, error) {
+	for !r.done {
+		rec, err := r.read()
+		if err != nil {
+			return nil, err
+		}
+		if !r.from.IsZero() && rec.Time.Before(r.from) {
+			continue
+		}
+		if !r.to.IsZero() && !rec.Time.Before(r.to) {
+			r.done = true
+			break
+		}
+		return rec, nil
+	}
+	return nil, io.EOF
+}
+
+func (r *Reader) read() (*Record, error) {
+	rec := r.next
+	r.next = nil
+
+	var msg, raw strings.Builder
+	for r.err == nil {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			r.err = err
+			if len(line) == 0 {
+				break
+			}
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if next, ok := ParseHeader(line); ok {
+			if rec != nil {
+				r.next = next
+				break
+			}
+			rec = next
+			continue
+		}
+
+		//continuation
+		if rec != nil {
+			if msg.Len() == 0 {
+				msg.WriteString(rec.Message)
+				raw.WriteString(rec.Raw)
+			}
+			msg.WriteByte('\n')
+			msg.WriteString(line)
+			raw.WriteByte('\n')
+			raw.WriteString(line)
+		}
+	}
+
+	err := r.err
+	if err == io.EOF {
+		r.err = nil
+	}
+	if rec == nil {
+		return nil, err
+	}
+	if msg.Len() != 0 {
+		rec.Message, rec.Raw = msg.String(), raw.String()
+	}
+	return rec, nil
+}
+
+//close files opened by Open
+func (r *Reader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	r.closers = nil
+	return err
+}
+
+//parse header line:
+//1949-10-01 07:00:00.000000 pid file:line [function] LVL | message
+func ParseHeader(line string) (*Record, bool) {
+	if len(line) < len(TimeLayout) + 1 || line[len(TimeLayout)] != ' ' || line[4] != '-' || line[10] != ' ' {
+		return nil, false
+	}
+	t, err := time.ParseInLocation(TimeLayout, line[:len(TimeLayout)], time.Local)
+	if err != nil {
+		return nil, false
+	}
+	rest := line[len(TimeLayout) + 1:]
+
+	//pid
+	idx := strings.IndexByte(rest, ' ')
+	if idx <= 0 {
+		return nil, false
+	}
+	pid, err := strconv.Atoi(rest[:idx])
+	if err != nil {
+		return nil, false
+	}
+	rest = rest[idx + 1:]
+
+	//caller and level before separator
+	idx = strings.Index(rest, " | ")
+	if idx < 4 || rest[idx - 4] != ' ' {
+		return nil, false
+	}
+	level, ok := ParseShortLevel(rest[idx - 3 : idx])
+	if !ok {
+		return nil, false
+	}
+	caller := rest[:idx - 4]
+	msg := rest[idx + 3:]
+
+	colon := strings.LastIndexByte(caller, ':')
+	if colon == -1 {
+		return nil, false
+	}
+	//file:line or file:line function
+	lineStr, function := caller[colon + 1:], ""
+	if idx := strings.IndexByte(lineStr, ' '); idx != -1 {
+		lineStr, function = lineStr[:idx], lineStr[idx + 1:]
+	}
+	lineNo, err := strconv.Atoi(lineStr)
+	if err != nil {
+		return nil, false
+	}
+
+	return &Record{
+		Time:    t,
+		Pid:     pid,
+		File:    caller[:colon],
+		Line:    lineNo,
+		Func:    function,
+		Level:   level,
+		Message: msg,
+		Raw:     line,
+	}, true
+}
+
+//DBG, INF, WAR or ERR
+func ParseShortLevel(s string) (purelog.Level, bool) {
+	switch s {
+	case "DBG", "INF", "WAR", "ERR":
+		return purelog.ParseLevel(s), true
+	}
+	return purelog.LevelDebug, false
+}
@@ -0,0 +1,173 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+//returns offset of the first entry at or after t in r of size bytes, size if none.
+//lines start with the fixed width timestamp, so the file is binary searched by
+//timestamp. entries must be in time order, which holds for a file written by
+//one logger.
+func Seek(r io.ReaderAt, size int64, t time.Time) (int64, error) {
+	//headers before lo are before t, hi is size or a header at or after t
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi - lo) / 2
+		off, rec, err := nextHeader(r, mid, hi)
+		if err != nil {
+			return 0, err
+		}
+		if rec == nil {
+			hi = mid
+		} else if rec.Time.Before(t) {
+			lo = off + 1
+		} else {
+			hi = off
+		}
+	}
+
+	off, rec, err := nextHeader(r, lo, size)
+	if err != nil {
+		return 0, err
+	}
+	if rec == nil {
+		return size, nil
+	}
+	return off, nil
+}
+
+//first header line starting in [off, limit)
+func nextHeader(r io.ReaderAt, off, limit int64) (int64, *Record, error) {
+	start := off
+	if start > 0 {
+		start--  //off itself starts a line if previous byte is '\n'
+	}
+	br := bufio.NewReaderSize(io.NewSectionReader(r, start, math.MaxInt64 - start), 4096)
+
+	pos := start
+	if off > 0 {
+		//skip to line start
+		line, err := br.ReadSlice('\n')
+		for err == bufio.ErrBufferFull {
+			pos += int64(len(line))
+			line, err = br.ReadSlice('\n')
+		}
+		if err != nil {
+			return 0, nil, ignoreEOF(err)
+		}
+		pos += int64(len(line))
+	}
+
+	for pos < limit {
+		line, err := br.ReadSlice('\n')
+		n := int64(len(line))
+		if err == bufio.ErrBufferFull {
+			//long line, header is at its start
+			if rec, ok := ParseHeader(string(line)); ok {
+				return pos, rec, nil
+			}
+			for err == bufio.ErrBufferFull {
+				line, err = br.ReadSlice('\n')
+				n += int64(len(line))
+			}
+		} else if rec, ok := ParseHeader(string(bytes.TrimSuffix(line, newline))); ok {
+			return pos, rec, nil
+		}
+		if err != nil {
+			return 0, nil, ignoreEOF(err)
+		}
+		pos += n
+	}
+	return 0, nil, nil
+}
+
+var newline = []byte{'\n'}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+//files of a set that may hold entries in [from, to), zero times are unbounded.
+//entries of a rotated file are before its rotation time; the file after the
+//last one rotated before to is kept, as an entry flushed at rotation may
+//continue in it.
+func SelectFiles(set []SetFile, from, to time.Time) []SetFile {
+	first := 0
+	if !from.IsZero() {
+		for first < len(set) && !set[first].Rotated.IsZero() && !set[first].Rotated.After(from) {
+			first++
+		}
+	}
+
+	last := len(set)
+	if !to.IsZero() {
+		for i := first; i < len(set) - 1; i++ {
+			if !set[i].Rotated.Before(to) {
+				last = i + 2
+				break
+			}
+		}
+	}
+	return set[first:last]
+}
+
+//read entries of file in [from, to), zero times are unbounded
+func OpenRange(file string, from, to time.Time) (*Reader, error) {
+	return openRange([]string{file}, from, to)
+}
+
+//read entries of the rotated set of file in [from, to), opening only files
+//selected by their names
+func OpenSetRange(file string, from, to time.Time) (*Reader, error) {
+	set, err := setOf(file)
+	if err != nil {
+		return nil, err
+	}
+	set = SelectFiles(set, from, to)
+	names := make([]string, len(set))
+	for i := range set {
+		names[i] = set[i].Name
+	}
+	return openRange(names, from, to)
+}
+
+func openRange(names []string, from, to time.Time) (*Reader, error) {
+	files, err := openFiles(names)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) != 0 && !from.IsZero() {
+		if err = seekFile(files[0], from); err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+	}
+
+	r := newFilesReader(files)
+	r.from, r.to = from, to
+	return r, nil
+}
+
+func seekFile(file *os.File, t time.Time) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	off, err := Seek(file, info.Size(), t)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(off, io.SeekStart)
+	return err
+}
@@ -0,0 +1,130 @@
+package purelogtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pure-project/purelog"
+)
+
+//fake purelog.Clock, time moves only by Add or Set.
+//
+//	clock := purelogtest.NewClock(time.Date(2022, 9, 12, 23, 49, 51, 0, time.Local))
+//	logger := purelog.New(purelog.NewConfig().SetFile(file).SetClock(clock))
+//	clock.BlockUntil(1)      //flush timer started
+//	logger.Info("msg")       //timestamp 2022-09-12 23:49:51.000000
+//	clock.Add(time.Second)   //fire flush timer
+//	clock.BlockUntil(1)      //flushed, timer reset
+type Clock struct {
+	mtx    sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer  //active timers
+}
+
+func NewClock(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.cond = sync.NewCond(&c.mtx)
+	return c
+}
+
+func (c *Clock) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) purelog.Timer {
+	t := &fakeTimer{c: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+//move time forward by d, firing due timers
+func (c *Clock) Add(d time.Duration) {
+	c.mtx.Lock()
+	c.set(c.now.Add(d))
+	c.mtx.Unlock()
+}
+
+//move time to t, firing due timers
+func (c *Clock) Set(t time.Time) {
+	c.mtx.Lock()
+	c.set(t)
+	c.mtx.Unlock()
+}
+
+//wait until n timers are active, e.g. a logger has reset its flush timer
+//after flushing
+func (c *Clock) BlockUntil(n int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *Clock) set(t time.Time) {
+	c.now = t
+	timers := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.when.After(t) {
+			timers = append(timers, timer)
+			continue
+		}
+		select {
+		case timer.ch <- t:
+		default:
+		}
+	}
+	for i := len(timers); i < len(c.timers); i++ {
+		c.timers[i] = nil
+	}
+	c.timers = timers
+	c.cond.Broadcast()
+}
+
+//remove timer, returns whether it was active
+func (c *Clock) remove(t *fakeTimer) bool {
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i + 1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	c    *Clock
+	ch   chan time.Time
+	when time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mtx.Lock()
+	defer t.c.mtx.Unlock()
+	active := t.c.remove(t)
+	t.when = t.c.now.Add(d)
+	if d <= 0 {
+		select {
+		case t.ch <- t.c.now:
+		default:
+		}
+	} else {
+		t.c.timers = append(t.c.timers, t)
+	}
+	t.c.cond.Broadcast()
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mtx.Lock()
+	defer t.c.mtx.Unlock()
+	return t.c.remove(t)
+}
@@ -0,0 +1,115 @@
+//Package purelogtest records log entries in memory for assertions in unit tests.
+//
+//	logger, rec := purelogtest.New(t)
+//	handle(logger, req)
+//	if !rec.Has(purelog.LevelError, "timeout") {
+//		t.Errorf("timeout not logged: %v", rec.Entries())
+//	}
+package purelogtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pure-project/purelog"
+)
+
+//sink keeps copies of entries, written synchronously so entries are
+//available as soon as the log call returns
+type Recorder struct {
+	level   uint32
+	mtx     sync.Mutex
+	entries []purelog.Entry
+}
+
+//new recorder, default level is debug
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+//new logger writing only into a new recorder, with caller enabled.
+//logger is closed when the test ends.
+func New(t testing.TB) (*purelog.Logger, *Recorder) {
+	rec := NewRecorder()
+	logger := purelog.New(purelog.NewConfig().SetCaller(true).AddSink(rec))
+	t.Cleanup(logger.Close)
+	return logger, rec
+}
+
+func (r *Recorder) SetLevel(level purelog.Level) *Recorder {
+	atomic.StoreUint32(&r.level, uint32(level))
+	return r
+}
+
+func (r *Recorder) Level() purelog.Level {
+	return purelog.Level(atomic.LoadUint32(&r.level))
+}
+
+func (r *Recorder) Write(e *purelog.Entry) {
+	//message and fields are only valid during Write
+	entry := *e
+	entry.Message = string(append([]byte(nil), e.Message...))
+	if len(e.Fields) != 0 {
+		entry.Fields = append([]purelog.Field(nil), e.Fields...)
+	}
+
+	r.mtx.Lock()
+	r.entries = append(r.entries, entry)
+	r.mtx.Unlock()
+}
+
+func (r *Recorder) Flush() error {
+	return nil
+}
+
+func (r *Recorder) Close() error {
+	return nil
+}
+
+//copy of recorded entries, oldest first
+func (r *Recorder) Entries() []purelog.Entry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]purelog.Entry(nil), r.entries...)
+}
+
+//whether an entry of level has substr in its message or a key=value field
+func (r *Recorder) Has(level purelog.Level, substr string) bool {
+	return r.Count(level, substr) != 0
+}
+
+//number of entries of level having substr in message or a key=value field
+func (r *Recorder) Count(level purelog.Level, substr string) int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	n := 0
+	for i := range r.entries {
+		if e := &r.entries[i]; e.Level == level && contains(e, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+//drop recorded entries
+func (r *Recorder) Reset() {
+	r.mtx.Lock()
+	r.entries = nil
+	r.mtx.Unlock()
+}
+
+func contains(e *purelog.Entry, substr string) bool {
+	if strings.Contains(e.Message, substr) {
+		return true
+	}
+	for _, f := range e.Fields {
+		if strings.Contains(f.Key + "=" + fmt.Sprint(f.Value), substr) {
+			return true
+		}
+	}
+	return false
+}
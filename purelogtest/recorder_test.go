@@ -0,0 +1,120 @@
+package purelogtest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pure-project/purelog"
+)
+
+func TestRecorder(t *testing.T) {
+	logger, rec := New(t)
+
+	logger.Debugf("request %d", 1)
+	logger.ErrorCtx(purelog.NewContext(context.Background(), purelog.F("user", "bob")), "upstream timeout")
+
+	//no wait needed
+	entries := rec.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries", len(entries))
+	}
+	if e := entries[0]; e.Level != purelog.LevelDebug || e.Message != "request 1" || !strings.HasSuffix(e.File, "recorder_test.go") || e.Line == 0 {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	if !rec.Has(purelog.LevelError, "timeout") || !rec.Has(purelog.LevelError, "user=bob") || !rec.Has(purelog.LevelDebug, "") {
+		t.Error("entry not found")
+	}
+	if rec.Has(purelog.LevelWarn, "timeout") || rec.Has(purelog.LevelError, "request") {
+		t.Error("unexpected entry found")
+	}
+
+	rec.Reset()
+	if len(rec.Entries()) != 0 || rec.Has(purelog.LevelError, "") {
+		t.Error("not reset")
+	}
+
+	//level
+	rec.SetLevel(purelog.LevelWarn)
+	logger.Info("dropped")
+	logger.Warn("kept")
+	if rec.Count(purelog.LevelInfo, "") != 0 || rec.Count(purelog.LevelWarn, "kept") != 1 {
+		t.Errorf("unexpected entries: %+v", rec.Entries())
+	}
+}
+
+func TestRecorderConcurrent(t *testing.T) {
+	logger, rec := New(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Infof("message %d", j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := rec.Count(purelog.LevelInfo, "message "); n != 800 {
+		t.Errorf("got %d entries", n)
+	}
+	//message copied out of logger's buffer
+	for _, e := range rec.Entries() {
+		if !strings.HasPrefix(e.Message, "message ") {
+			t.Fatalf("corrupted message %q", e.Message)
+		}
+	}
+}
+
+func TestClock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "purelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.log")
+
+	now := time.Date(2022, 9, 12, 23, 49, 51, 0, time.Local)
+	clock := NewClock(now)
+	logger := purelog.New(purelog.NewConfig().SetFile(file).SetSize(100).SetFlush(time.Minute).SetClock(clock))
+	defer logger.Close()
+	clock.BlockUntil(1)
+
+	//stable timestamp
+	logger.Info("first")
+	clock.Add(30 * time.Second)
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("flushed before interval: %v", err)
+	}
+
+	//flush interval
+	clock.Add(30 * time.Second)
+	clock.BlockUntil(1)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "2022-09-12 23:49:51.000000 ") {
+		t.Errorf("unexpected output: %s", data)
+	}
+
+	//rotate twice at the same time, names stay unique
+	logger.Info(strings.Repeat("x", 100))
+	logger.Info(strings.Repeat("y", 100))
+	clock.Add(time.Minute)
+	clock.BlockUntil(1)
+	for _, name := range []string{"test_2022-09-12_23-51-51_000000000.log", "test_2022-09-12_23-51-51_000000001.log"} {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package purelog
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+//sink keeps the last entries in memory, for crash dumps and debug endpoints
+//
+//the ring records entries at its own level, regardless of the main output level,
+//and is written synchronously, so it's up to date at any time.
+type RingSink struct {
+	level   uint32
+	encoder atomic.Value
+	mtx     sync.Mutex
+	ring    [][]byte  //encoded entries, ring[head] is the oldest
+	head    int
+	count   int
+	bytes   int
+	maxSize int
+}
+
+//new ring sink keeping at most count entries
+//
+//default level is debug and encoder is TextEncoder.
+func NewRingSink(count int) *RingSink {
+	if count <= 0 {
+		count = 1
+	}
+	s := &RingSink{ring: make([][]byte, count)}
+	s.encoder.Store(encoderHolder{TextEncoder})
+	return s
+}
+
+func (s *RingSink) SetLevel(level Level) *RingSink {
+	atomic.StoreUint32(&s.level, uint32(level))
+	return s
+}
+
+func (s *RingSink) SetEncoder(encoder Encoder) *RingSink {
+	s.encoder.Store(encoderHolder{encoder})
+	return s
+}
+
+//also limit total size of kept entries, 0 means no limit
+func (s *RingSink) SetSize(size uint) *RingSink {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.maxSize = int(size)
+	s.evict()
+	return s
+}
+
+func (s *RingSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.level))
+}
+
+func (s *RingSink) Write(e *Entry) {
+	encoder := s.encoder.Load().(encoderHolder).Encoder
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	//full, overwrite the oldest
+	if s.count == len(s.ring) {
+		s.bytes -= len(s.ring[s.head])
+		s.head = (s.head + 1) % len(s.ring)
+		s.count--
+	}
+
+	i := (s.head + s.count) % len(s.ring)
+	s.ring[i] = encoder.Encode(s.ring[i][:0], e)
+	s.bytes += len(s.ring[i])
+	s.count++
+	s.evict()
+}
+
+//nothing pending, entries are kept until overwritten
+func (s *RingSink) Flush() error {
+	return nil
+}
+
+func (s *RingSink) Close() error {
+	return nil
+}
+
+//write kept entries to w, oldest first
+//
+//entries are copied out first, a slow writer doesn't block logging.
+func (s *RingSink) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(s.Bytes())
+	return int64(n), err
+}
+
+//returns copy of kept entries, oldest first
+func (s *RingSink) Bytes() []byte {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	data := make([]byte, 0, s.bytes)
+	for i := 0; i < s.count; i++ {
+		data = append(data, s.ring[(s.head + i) % len(s.ring)]...)
+	}
+	return data
+}
+
+//drop all kept entries
+func (s *RingSink) Reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i := range s.ring {
+		s.ring[i] = nil
+	}
+	s.head, s.count, s.bytes = 0, 0, 0
+}
+
+//serve kept entries as plain text, for admin endpoints
+func (s *RingSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = s.WriteTo(w)
+}
+
+//drop oldest entries over size limit, keep the newest one anyway
+func (s *RingSink) evict() {
+	for s.maxSize != 0 && s.bytes > s.maxSize && s.count > 1 {
+		s.bytes -= len(s.ring[s.head])
+		s.ring[s.head] = nil  //release large entries
+		s.head = (s.head + 1) % len(s.ring)
+		s.count--
+	}
+}
@@ -0,0 +1,214 @@
+package purelog
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//log entry passed to sinks
+//
+//Message and Fields are only valid during Sink.Write, copy them if need to keep.
+type Entry struct {
+	Time     time.Time
+	Level    Level
+	Pid      int
+	File     string
+	Line     int
+	Function string  //empty unless Config.SetCallerFunc
+	Message  string
+	Fields   []Field
+	Stack    string  //empty below Config.SetStacktraceLevel
+}
+
+//log output
+//
+//Write is called by logging goroutines, Flush by the logger's flush goroutine,
+//so a sink should buffer in Write and do the slow output in Flush.
+type Sink interface {
+	//minimum level of entries written to sink
+	Level() Level
+	//encode entry into pending data
+	Write(e *Entry)
+	//write pending data out
+	Flush() error
+	//flush and release resources
+	Close() error
+}
+
+//sink defaulting its files to the logger's file, e.g. NetworkSink spill file
+type logFileSink interface {
+	setLogFile(file string)
+}
+
+
+//writer sink:
+
+//sink writes to io.Writer (e.g. os.Stderr)
+type WriterSink struct {
+	level   uint32
+	encoder atomic.Value
+	w       io.Writer
+	db      doubleBuffer
+}
+
+//new writer sink, default level is debug and encoder is TextEncoder
+func NewWriterSink(w io.Writer) *WriterSink {
+	s := &WriterSink{w: w}
+	s.encoder.Store(encoderHolder{TextEncoder})
+	s.db.init()
+	return s
+}
+
+func (s *WriterSink) SetLevel(level Level) *WriterSink {
+	atomic.StoreUint32(&s.level, uint32(level))
+	return s
+}
+
+func (s *WriterSink) SetEncoder(encoder Encoder) *WriterSink {
+	s.encoder.Store(encoderHolder{encoder})
+	return s
+}
+
+func (s *WriterSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.level))
+}
+
+func (s *WriterSink) Write(e *Entry) {
+	s.db.write(s.encoder.Load().(encoderHolder).Encoder, e)
+}
+
+func (s *WriterSink) Flush() error {
+	buf := s.db.swap()
+	defer s.db.recycle()
+	if buf.Len() == 0 {
+		return nil
+	}
+	_, err := s.w.Write(buf.Data)
+	return err
+}
+
+func (s *WriterSink) Close() error {
+	return s.Flush()
+}
+
+
+//file sink:
+
+//sink writes to file with its own rotation settings
+type FileSink struct {
+	level   uint32
+	count   uint32
+	size    uint64
+	encoder atomic.Value
+	clock   atomic.Value
+	file    string
+	db      doubleBuffer
+	fw      fileWriter
+}
+
+//new file sink, default level is debug, encoder is TextEncoder and no rotation
+func NewFileSink(file string) *FileSink {
+	s := &FileSink{file: file}
+	s.encoder.Store(encoderHolder{TextEncoder})
+	s.clock.Store(systemClockHolder)
+	s.db.init()
+	return s
+}
+
+func (s *FileSink) SetLevel(level Level) *FileSink {
+	atomic.StoreUint32(&s.level, uint32(level))
+	return s
+}
+
+func (s *FileSink) SetEncoder(encoder Encoder) *FileSink {
+	s.encoder.Store(encoderHolder{encoder})
+	return s
+}
+
+//set single file size, 0 means no rotation
+func (s *FileSink) SetSize(size uint) *FileSink {
+	atomic.StoreUint64(&s.size, uint64(size))
+	return s
+}
+
+//set max rotated file count, 0 means unlimited
+func (s *FileSink) SetCount(count uint) *FileSink {
+	atomic.StoreUint32(&s.count, uint32(count))
+	return s
+}
+
+//set time source of rotated file names, SystemClock by default
+func (s *FileSink) SetClock(clock Clock) *FileSink {
+	s.clock.Store(&clockHolder{clock})
+	return s
+}
+
+func (s *FileSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.level))
+}
+
+func (s *FileSink) Write(e *Entry) {
+	s.db.write(s.encoder.Load().(encoderHolder).Encoder, e)
+}
+
+func (s *FileSink) Flush() error {
+	buf := s.db.swap()
+	defer s.db.recycle()
+	if buf.Len() == 0 {
+		return nil
+	}
+	return s.fw.write(s.file, buf.Data, s.db.ends2, atomic.LoadUint64(&s.size), atomic.LoadUint32(&s.count), s.clock.Load().(*clockHolder).Clock)
+}
+
+func (s *FileSink) Close() error {
+	return s.Flush()
+}
+
+
+//utils:
+
+//atomic.Value requires consistent concrete type
+type encoderHolder struct {
+	Encoder
+}
+
+//pending data of sink: front buffer written by logging goroutines, back buffer by flush
+type doubleBuffer struct {
+	mtx   sync.Mutex
+	fmtx  sync.Mutex
+	buf   *buffer
+	buf2  *buffer
+	ends  []int  //end offsets of entries in buf
+	ends2 []int  //end offsets of entries in buf2
+}
+
+func (db *doubleBuffer) init() {
+	db.buf  = &buffer{ Data: make([]byte, 0, fileBufSizeMin) }
+	db.buf2 = &buffer{ Data: make([]byte, 0, fileBufSizeMin) }
+}
+
+func (db *doubleBuffer) write(encoder Encoder, e *Entry) {
+	db.mtx.Lock()
+	db.buf.Data = encoder.Encode(db.buf.Data, e)
+	db.ends = append(db.ends, len(db.buf.Data))
+	db.mtx.Unlock()
+}
+
+//swap buffers and return back buffer, must be followed by recycle
+func (db *doubleBuffer) swap() *buffer {
+	db.fmtx.Lock()
+	db.mtx.Lock()
+	db.buf, db.buf2 = db.buf2, db.buf
+	db.ends, db.ends2 = db.ends2, db.ends
+	db.mtx.Unlock()
+	return db.buf2
+}
+
+//release back buffer
+func (db *doubleBuffer) recycle() {
+	recycleBuffer(db.buf2)
+	db.ends2 = db.ends2[:0]
+	db.fmtx.Unlock()
+}
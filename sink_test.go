@@ -0,0 +1,675 @@
+package purelog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+
+//syslog:
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink := NewSyslogSink("udp", pc.LocalAddr().String()).
+		SetHostname("host").
+		SetAppName("app").
+		SetFacility(FacilityLocal0)
+	logger := New(NewConfig().AddSink(sink))
+	logger.Warn("disk full")
+	logger.Error("boom")
+	logger.Close()
+
+	want := []string{
+		"<132>1 ",  //local0(16) * 8 + warning(4)
+		"<131>1 ",  //local0(16) * 8 + error(3)
+	}
+	buf := make([]byte, 64 * 1024)
+	for _, prefix := range want {
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, prefix) || !strings.Contains(msg, " host app " + strconv.Itoa(logger.pid) + " - - ") {
+			t.Errorf("unexpected message: %s", msg)
+		}
+	}
+}
+
+func TestSyslogUDPTooLarge(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink := NewSyslogSink("udp", pc.LocalAddr().String())
+	sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Pid: 1, Message: strings.Repeat("x", 70 * 1024)})
+	if err := sink.Flush(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	//later messages are delivered
+	sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Pid: 1, Message: "small"})
+	if err := sink.Flush(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	sink.Close()
+
+	buf := make([]byte, 64 * 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); !strings.HasSuffix(msg, " small") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
+
+func TestSyslogTCPReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	//accept connections, read one frame per connection then drop it
+	frames := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			size, err := r.ReadString(' ')
+			if err == nil {
+				n, _ := strconv.Atoi(strings.TrimSpace(size))
+				msg := make([]byte, n)
+				if _, err = io.ReadFull(r, msg); err == nil {
+					frames <- string(msg)
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	sink := NewSyslogSink("tcp", ln.Addr().String()).SetFormat(SyslogRFC3164).SetAppName("app")
+	for i := 0; i < 3; i++ {
+		sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Pid: 1, File: "a/b.go", Line: 7, Message: "msg " + strconv.Itoa(i)})
+		//the first write after the peer dropped may succeed, flush until delivered
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_ = sink.Flush()
+			select {
+			case msg := <-frames:
+				if strings.HasSuffix(msg, " msg " + strconv.Itoa(i - 1)) {
+					continue  //resent with pending frames
+				}
+				if !strings.HasPrefix(msg, "<14>") || !strings.HasSuffix(msg, " app[1]: a/b.go:7 msg " + strconv.Itoa(i)) {
+					t.Errorf("unexpected message: %s", msg)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if time.Now().Before(deadline) {
+					sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Pid: 1, File: "a/b.go", Line: 7, Message: "msg " + strconv.Itoa(i)})
+					continue
+				}
+				t.Fatalf("message %d not delivered", i)
+			}
+			break
+		}
+	}
+	sink.Close()
+}
+
+func TestSyslogLocal(t *testing.T) {
+	addr := filepath.Join(tempFile(t, ""), "log.sock")
+	pc, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+
+	sink := NewSyslogSink("", addr)
+	sink.Write(&Entry{Time: time.Now(), Level: LevelDebug, Message: "line1\nline2"})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<15>1 ") || !strings.HasSuffix(msg, `line1\nline2`) {
+		t.Errorf("unexpected message: %q", msg)
+	}
+}
+
+func TestSyslogPending(t *testing.T) {
+	//free port, nothing listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sink := NewSyslogSink("tcp", addr).SetFormat(SyslogRFC3164).SetAppName("app")
+	for i := 0; i < 3; i++ {
+		sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Pid: 1, Message: "msg " + strconv.Itoa(i)})
+	}
+	if err := sink.Flush(); err == nil {
+		t.Fatal("no error while collector is down")
+	}
+	if err := sink.Flush(); err != nil {
+		t.Errorf("failure reported again: %v", err)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	//kept frames are sent after backoff
+	sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Pid: 1, Message: "msg 3"})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.pending) != 0 || sink.conn == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("pending frames not sent")
+		}
+		time.Sleep(50 * time.Millisecond)
+		_ = sink.Flush()
+	}
+	sink.Close()
+
+	data := <-received
+	for i := 0; i < 4; i++ {
+		if !strings.Contains(data, " msg " + strconv.Itoa(i)) {
+			t.Errorf("msg %d not received: %q", i, data)
+		}
+	}
+}
+
+func TestOctetCounting(t *testing.T) {
+	var data []byte
+	for _, msg := range []string{"a", "hello world", ""} {
+		beg := len(data)
+		data = append(data, msg...)
+		data = prependLength(data, beg)
+	}
+	if string(data) != "1 a11 hello world0 " {
+		t.Fatalf("unexpected frames: %q", data)
+	}
+
+	var msgs []string
+	for rest := data; len(rest) != 0; {
+		var msg []byte
+		msg, rest = nextFrame(rest)
+		if msg == nil {
+			t.Fatalf("bad frame: %q", rest)
+		}
+		msgs = append(msgs, string(msg))
+	}
+	if strings.Join(msgs, "|") != "a|hello world|" {
+		t.Errorf("unexpected messages: %q", msgs)
+	}
+
+	if off := frameStart(data, 5); off != 3 {
+		t.Errorf("frameStart = %d, want 3", off)
+	}
+}
+
+
+//network:
+
+func TestNetworkSpill(t *testing.T) {
+	//reserve a port with nothing listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spill := tempFile(t, "app.log.spill")
+	sink := NewNetworkSink("tcp", addr).
+		SetSpill(spill, 1024).
+		SetBackoff(time.Millisecond, time.Millisecond)
+	sink.chunk = 64  //replay in several chunks
+
+	write := func(msg string) {
+		sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, File: "a.go", Line: 1, Message: msg})
+	}
+
+	//disconnected: first failure reported, then spilled quietly
+	write("spill1")
+	if err := sink.Flush(); err == nil {
+		t.Errorf("expected send error")
+	}
+	write("spill2")
+	time.Sleep(5 * time.Millisecond)
+	if err := sink.Flush(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if data := readFile(t, spill); strings.Count(data, "\n") != 2 {
+		t.Fatalf("unexpected spill file:\n%s", data)
+	}
+
+	//overflow drops newest lines
+	write(strings.Repeat("x", 2048))
+	if err := sink.Flush(); err == nil || !strings.Contains(err.Error(), "dropped") {
+		t.Errorf("expected overflow error, got %v", err)
+	}
+
+	//collector comes up: spilled lines replayed before new ones
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	write("live")
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"spill1", "spill2", "live"} {
+		select {
+		case line := <-lines:
+			if !strings.HasSuffix(line, "INF | " + want) {
+				t.Errorf("got %q, want %s", line, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not received", want)
+		}
+	}
+	if _, err := os.Stat(spill); !os.IsNotExist(err) {
+		t.Errorf("spill file not removed: %v", err)
+	}
+}
+
+func TestNetworkSpillDefault(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	//next to logger's file, bounded by default
+	file := tempFile(t, "app.log")
+	sink := NewNetworkSink("tcp", addr)
+	logger := New(NewConfig().SetFile(file).AddSink(sink))
+	logger.Info("spill")
+	logger.Close()
+	if data := readFile(t, file + ".spill"); !strings.Contains(data, "INF | spill\n") {
+		t.Errorf("unexpected spill file:\n%s", data)
+	}
+	if sink.spillSize != netSpillSize || NewNetworkSink("tcp", addr).SetSpill(file, 0).spillSize != netSpillSize {
+		t.Errorf("unbounded spill file")
+	}
+
+	//unsent part kept after partial replay
+	spill := tempFile(t, "trim.spill")
+	ioutil.WriteFile(spill, []byte("sent\nkept\n"), 0666)
+	if err := NewNetworkSink("tcp", addr).SetSpill(spill, 0).trimSpill(5); err != nil {
+		t.Fatal(err)
+	}
+	if data := readFile(t, spill); data != "kept\n" {
+		t.Errorf("unexpected spill file: %q", data)
+	}
+}
+
+func TestNetworkUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	sink := NewNetworkSink("udp", pc.LocalAddr().String()).SetEncoder(JSONEncoder)
+	big := strings.Repeat("y", netDatagramSize / 2)
+	for i := 0; i < 3; i++ {
+		sink.Write(&Entry{Time: time.Now(), Level: LevelWarn, Message: big})
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//whole lines packed into datagrams
+	buf := make([]byte, 64 * 1024)
+	count := 0
+	for count < 3 {
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > netDatagramSize || buf[n-1] != '\n' {
+			t.Fatalf("bad datagram size %d", n)
+		}
+		count += bytes.Count(buf[:n], []byte{'\n'})
+	}
+}
+
+
+//http:
+
+func TestHTTPSink(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests int
+		lines    []string
+	)
+	fail := int32(1)  //first request fails
+	attempts := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.AddInt32(&fail, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		data, _ := ioutil.ReadAll(body)
+		if r.Header.Get("Content-Type") != "application/x-ndjson" || r.Header.Get("X-Token") != "secret" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		requests++
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			var entry map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Errorf("bad line %q: %v", line, err)
+			}
+			lines = append(lines, entry["msg"].(string))
+		}
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL).
+		SetGzip(true).
+		SetRetry(0).
+		SetBatchSize(200).
+		SetHeader("X-Token", "secret")
+	write := func(msg string) {
+		sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Message: msg})
+	}
+
+	//collector unavailable: queued for retry after backoff, reported once
+	write("a")
+	write("b")
+	if err := sink.Flush(); err == nil {
+		t.Errorf("expected post error")
+	}
+	write("c")
+	if err := sink.Flush(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("%d requests while backing off", n)
+	}
+
+	//recovered: queued batches first, split by batch size
+	write("d")
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if strings.Join(lines, "") != "abcd" {
+		t.Errorf("unexpected lines: %v", lines)
+	}
+	if requests < 2 {
+		t.Errorf("expected multiple batches, got %d requests", requests)
+	}
+}
+
+func TestHTTPSinkQueueBound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL).SetRetry(0).SetQueueSize(300)
+	for i := 0; i < 10; i++ {
+		sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Message: strings.Repeat("z", 100)})
+	}
+	if err := sink.Flush(); err == nil || !strings.Contains(err.Error(), "dropped") {
+		t.Errorf("expected drop error, got %v", err)
+	}
+	if sink.queued > 300 {
+		t.Errorf("queue exceeds bound: %d", sink.queued)
+	}
+}
+
+func TestHTTPSinkBadURL(t *testing.T) {
+	sink := NewHTTPSink("http://[::1/logs")
+	sink.Write(&Entry{Time: time.Now(), Level: LevelInfo, Message: "lost"})
+	if err := sink.Flush(); err == nil {
+		t.Error("no error for bad url")
+	}
+	if len(sink.queue) != 0 {
+		t.Errorf("batch queued for retry: %d", len(sink.queue))
+	}
+}
+
+func TestNextBatch(t *testing.T) {
+	data := []byte("aa\nbbbb\ncc\n")
+	var batches []string
+	for len(data) != 0 {
+		var batch []byte
+		batch, data = nextBatch(data, 4)
+		batches = append(batches, string(batch))
+	}
+	if strings.Join(batches, "|") != "aa\n|bbbb\n|cc\n" {
+		t.Errorf("unexpected batches: %q", batches)
+	}
+}
+
+
+//ring:
+
+func TestRingSink(t *testing.T) {
+	file := tempFile(t, "ring.log")
+	ring := NewRingSink(3)
+	logger := New(NewConfig().
+		SetLevel(LevelError).
+		SetFile(file).
+		AddSink(ring))
+
+	for i := 0; i < 5; i++ {
+		logger.Debugf("debug %d", i)
+	}
+	logger.Error("error")
+
+	//written synchronously, newest 3 kept
+	data := string(ring.Bytes())
+	if strings.Count(data, "\n") != 3 || !strings.Contains(data, "DBG | debug 3\n") || !strings.Contains(data, "ERR | error\n") {
+		t.Errorf("unexpected ring:\n%s", data)
+	}
+	logger.Close()
+
+	//below main output level, not in file
+	if data := readFile(t, file); strings.Contains(data, "debug") || !strings.Contains(data, "ERR | error\n") {
+		t.Errorf("unexpected file:\n%s", data)
+	}
+
+	//admin endpoint
+	rec := httptest.NewRecorder()
+	ring.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/logs", nil))
+	if rec.Body.String() != string(ring.Bytes()) {
+		t.Errorf("unexpected response:\n%s", rec.Body.String())
+	}
+
+	ring.Reset()
+	if len(ring.Bytes()) != 0 {
+		t.Errorf("ring not reset")
+	}
+}
+
+func TestRingSinkSize(t *testing.T) {
+	ring := NewRingSink(100).SetSize(50).SetEncoder(JSONEncoder)
+	for i := 0; i < 10; i++ {
+		ring.Write(&Entry{Level: LevelDebug, Message: strconv.Itoa(i)})
+	}
+
+	//only the newest entry fits 50 bytes
+	data := string(ring.Bytes())
+	if strings.Count(data, "\n") != 1 || !strings.Contains(data, `"msg":"9"`) {
+		t.Errorf("unexpected ring:\n%s", data)
+	}
+}
+
+
+//tail:
+
+func TestTailSink(t *testing.T) {
+	tail := NewTailSink()
+	logger := New(NewConfig().AddSink(tail).SetFlush(time.Hour))
+	defer logger.Close()
+	if tail.Level() != LevelOff {
+		t.Errorf("level %s without subscribers", tail.Level())
+	}
+
+	server := httptest.NewServer(tail)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?level=warn&q=disk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+	if tail.Level() != LevelWarn {
+		t.Errorf("level %s with warn subscriber", tail.Level())
+	}
+
+	logger.Warn("disk full")
+	logger.Error("network down")
+	logger.Info("disk ok")
+	logger.Error("disk\nfailed")
+	logger.Flush()
+
+	events := readEvents(t, bufio.NewReader(resp.Body), 2)
+	if !strings.HasSuffix(events[0], "WAR | disk full") {
+		t.Errorf("unexpected event: %q", events[0])
+	}
+	if !strings.HasSuffix(events[1], "ERR | disk\ndata: failed") {
+		t.Errorf("unexpected event: %q", events[1])
+	}
+
+	//typo doesn't stream everything
+	bad, err := http.Get(server.URL + "?level=eror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Body.Close()
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown level status %d", bad.StatusCode)
+	}
+}
+
+func TestTailSinkDrop(t *testing.T) {
+	tail := NewTailSink().SetQueueSize(1)
+	sub := &tailSub{ch: make(chan string, 1)}
+	tail.subscribe(sub)
+
+	//slow subscriber: queue holds 1, the rest dropped without blocking flush
+	for i := 0; i < 5; i++ {
+		tail.Write(&Entry{Level: LevelInfo, Message: strconv.Itoa(i)})
+	}
+	if err := tail.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.ch) != 1 || sub.dropped != 4 {
+		t.Errorf("queued %d, dropped %d", len(sub.ch), sub.dropped)
+	}
+
+	event := string(appendEvent(nil, "dropped", "dropped 4 entries"))
+	if event != "event: dropped\ndata: dropped 4 entries\n\n" {
+		t.Errorf("unexpected event: %q", event)
+	}
+}
+
+//read n events
+func readEvents(t *testing.T, r *bufio.Reader, n int) []string {
+	var events []string
+	var event []string
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if len(line) == 0 {
+			if len(event) != 0 {
+				events = append(events, strings.Join(event, "\n"))
+				event = nil
+			}
+			continue
+		}
+		event = append(event, line)
+	}
+	return events
+}
@@ -0,0 +1,462 @@
+package purelog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+//syslog message format
+type SyslogFormat uint32
+const (
+	SyslogRFC5424 SyslogFormat = iota  //<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	SyslogRFC3164                      //<PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+)
+
+//syslog facilities
+const (
+	FacilityKern   = 0
+	FacilityUser   = 1
+	FacilityDaemon = 3
+	FacilityLocal0 = 16
+	FacilityLocal1 = 17
+	FacilityLocal2 = 18
+	FacilityLocal3 = 19
+	FacilityLocal4 = 20
+	FacilityLocal5 = 21
+	FacilityLocal6 = 22
+	FacilityLocal7 = 23
+)
+
+const (
+	syslogDialTimeout = time.Second             //dial runs on the flush goroutine
+	syslogBackoffMin  = 100 * time.Millisecond  //first reconnect delay
+	syslogBackoffMax  = 30 * time.Second        //max reconnect delay
+	syslogPendingMax  = 1024 * 1024             //max unsent frames kept between flushes
+)
+
+var errSyslogBackoff = errors.New("syslog: waiting to reconnect")
+
+//local syslog sockets, tried in order
+var syslogLocalAddrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+var newline = []byte{'\n'}
+
+//sink writes to syslog over unix socket, udp or tcp
+//
+//entries are kept with octet-counting framing (RFC 6587) in buffer, written as is over
+//tcp, one datagram per entry over udp/unixgram and newline-terminated over unix stream.
+//
+//unsent entries are kept until a later flush reconnects, oldest are dropped over 1MB.
+//entries too large for a datagram (EMSGSIZE) are dropped and reported.
+type SyslogSink struct {
+	level    uint32
+	format   uint32
+	facility uint32
+	escape   uint32
+	network  string
+	addr     string
+	hostname string
+	appName  string
+	db       doubleBuffer
+
+	//used by flush only
+	conn     net.Conn
+	connNet  string
+	pending  []byte  //unsent frames
+	backoff  time.Duration
+	retryAt  time.Time
+	down     bool  //send failure reported
+	large    int   //datagrams dropped as too large
+}
+
+//new syslog sink, network is "unixgram", "unix", "udp" or "tcp",
+//empty network and addr mean local syslog (/dev/log).
+//
+//default level is debug, format is RFC 5424, facility is user and escape is EscapeControl.
+func NewSyslogSink(network, addr string) *SyslogSink {
+	s := &SyslogSink{
+		network:  network,
+		addr:     addr,
+		facility: FacilityUser,
+		escape:   uint32(EscapeControl),
+		appName:  filepath.Base(os.Args[0]),
+	}
+	s.hostname, _ = os.Hostname()
+	s.db.init()
+	return s
+}
+
+func (s *SyslogSink) SetLevel(level Level) *SyslogSink {
+	atomic.StoreUint32(&s.level, uint32(level))
+	return s
+}
+
+func (s *SyslogSink) SetFormat(format SyslogFormat) *SyslogSink {
+	atomic.StoreUint32(&s.format, uint32(format))
+	return s
+}
+
+func (s *SyslogSink) SetFacility(facility int) *SyslogSink {
+	atomic.StoreUint32(&s.facility, uint32(facility))
+	return s
+}
+
+//escape newlines and control characters of messages, EscapeControl by default
+//as newlines end messages over unix stream sockets
+func (s *SyslogSink) SetEscape(mode Escape) *SyslogSink {
+	atomic.StoreUint32(&s.escape, uint32(mode))
+	return s
+}
+
+//set hostname, must be called before logging
+func (s *SyslogSink) SetHostname(hostname string) *SyslogSink {
+	s.hostname = hostname
+	return s
+}
+
+//set app name (tag), must be called before logging
+func (s *SyslogSink) SetAppName(appName string) *SyslogSink {
+	s.appName = appName
+	return s
+}
+
+func (s *SyslogSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.level))
+}
+
+func (s *SyslogSink) Write(e *Entry) {
+	s.db.write(syslogEncoder{s}, e)
+}
+
+func (s *SyslogSink) Flush() error {
+	buf := s.db.swap()
+	defer s.db.recycle()
+	if buf.Len() == 0 && len(s.pending) == 0 {
+		return nil
+	}
+
+	//unsent frames of previous flushes first
+	data := buf.Data
+	if len(s.pending) != 0 {
+		s.pending = append(s.pending, data...)
+		data = s.pending
+	}
+
+	rest, err := s.send(data)
+	dropped := s.keep(rest)
+	large := s.large
+	s.large = 0
+
+	var report error
+	if err == nil {
+		s.down = false
+	} else if !s.down && err != errSyslogBackoff {
+		s.down = true
+		report = fmt.Errorf("syslog: send to %s err: %v", s.addr, err)
+	}
+	if dropped != 0 {
+		return fmt.Errorf("syslog: %d unsent messages over %d bytes dropped", dropped, syslogPendingMax)
+	}
+	if report == nil && large != 0 {
+		return fmt.Errorf("syslog: %d messages too large for a datagram dropped", large)
+	}
+	return report
+}
+
+//keep unsent frames for next flush, returns number of oldest frames dropped over syslogPendingMax
+func (s *SyslogSink) keep(rest []byte) int {
+	dropped := 0
+	for len(rest) > syslogPendingMax {
+		msg, next := nextFrame(rest)
+		if msg == nil {
+			rest = nil
+			break
+		}
+		rest = next
+		dropped++
+	}
+	//rest may be the tail of pending
+	s.pending = append(s.pending[:0], rest...)
+	return dropped
+}
+
+func (s *SyslogSink) Close() error {
+	err := s.Flush()
+
+	s.db.fmtx.Lock()
+	defer s.db.fmtx.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+//send framed messages, returns unsent data. a broken connection is redialed
+//once right away, failed dials back off.
+func (s *SyslogSink) send(data []byte) ([]byte, error) {
+	var err error
+	for retry := 0; retry < 2; retry++ {
+		if err = s.connect(); err != nil {
+			return data, err
+		}
+
+		data, err = s.write(data)
+		if err == nil {
+			return nil, nil
+		}
+
+		//broken connection, reconnect
+		s.conn.Close()
+		s.conn = nil
+	}
+	return data, err
+}
+
+//dial if disconnected and backoff elapsed
+func (s *SyslogSink) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Before(s.retryAt) {
+		return errSyslogBackoff
+	}
+	err := s.dial()
+	if err != nil {
+		//exponential backoff
+		s.backoff = maxDuration(syslogBackoffMin, s.backoff * 2)
+		if s.backoff > syslogBackoffMax {
+			s.backoff = syslogBackoffMax
+		}
+		s.retryAt = now.Add(s.backoff)
+		return err
+	}
+	s.backoff = 0
+	return nil
+}
+
+func (s *SyslogSink) dial() error {
+	if len(s.network) != 0 {
+		conn, err := net.DialTimeout(s.network, s.addr, syslogDialTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn, s.connNet = conn, s.network
+		return nil
+	}
+
+	//local syslog
+	addrs := syslogLocalAddrs
+	if len(s.addr) != 0 {
+		addrs = []string{s.addr}
+	}
+	var err error
+	for _, addr := range addrs {
+		for _, network := range []string{"unixgram", "unix"} {
+			var conn net.Conn
+			conn, err = net.DialTimeout(network, addr, syslogDialTimeout)
+			if err == nil {
+				s.conn, s.connNet = conn, network
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+//write framed messages, returns unsent data on error
+func (s *SyslogSink) write(data []byte) ([]byte, error) {
+	switch s.connNet {
+	case "tcp", "tcp4", "tcp6":
+		//octet counting
+		n, err := s.conn.Write(data)
+		if err != nil {
+			//resend from the first partial message
+			return data[frameStart(data, n):], err
+		}
+		return nil, nil
+	}
+
+	stream := s.connNet == "unix"
+	for len(data) != 0 {
+		msg, next := nextFrame(data)
+		if msg == nil {
+			return nil, errors.New("syslog: bad frame")
+		}
+
+		var err error
+		if stream {
+			//newline delimited
+			bufs := net.Buffers{msg, newline}
+			_, err = bufs.WriteTo(s.conn)
+		} else {
+			_, err = s.conn.Write(msg)
+			if err != nil && errors.Is(err, syscall.EMSGSIZE) {
+				//resending can't succeed, drop it
+				s.large++
+				err = nil
+			}
+		}
+		if err != nil {
+			return data, err
+		}
+		data = next
+	}
+	return nil, nil
+}
+
+
+//encoder:
+
+//syslog encoder, emits "LEN SP MSG"
+type syslogEncoder struct {
+	s *SyslogSink
+}
+
+func (enc syslogEncoder) Encode(buf []byte, e *Entry) []byte {
+	s := enc.s
+	beg := len(buf)
+
+	pri := atomic.LoadUint32(&s.facility) * 8 + uint32(syslogSeverity(e.Level))
+	buf = append(buf, '<')
+	buf = strconv.AppendUint(buf, uint64(pri), 10)
+	buf = append(buf, '>')
+
+	if SyslogFormat(atomic.LoadUint32(&s.format)) == SyslogRFC3164 {
+		buf = e.Time.AppendFormat(buf, time.Stamp)
+		buf = append(buf, ' ')
+		buf = appendSyslogName(buf, s.hostname, 255)
+		buf = append(buf, ' ')
+		buf = appendSyslogName(buf, s.appName, 32)
+		buf = append(buf, '[')
+		buf = strconv.AppendInt(buf, int64(e.Pid), 10)
+		buf = append(buf, "]: "...)
+	} else {
+		buf = append(buf, "1 "...)
+		buf = e.Time.AppendFormat(buf, "2006-01-02T15:04:05.000000Z07:00")
+		buf = append(buf, ' ')
+		buf = appendSyslogName(buf, s.hostname, 255)
+		buf = append(buf, ' ')
+		buf = appendSyslogName(buf, s.appName, 48)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(e.Pid), 10)
+		buf = append(buf, " - - "...)  //no msgid and structured data
+	}
+
+	//file:line message key=value
+	buf = append(buf, e.File...)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(e.Line), 10)
+	buf = append(buf, ' ')
+	buf = appendEscaped(buf, e.Message, Escape(atomic.LoadUint32(&s.escape)))
+	buf = appendFields(buf, e.Fields)
+
+	return prependLength(buf, beg)
+}
+
+//map level to syslog severity
+func syslogSeverity(level Level) int {
+	switch level {
+	case LevelDebug:
+		return 7  //debug
+	case LevelInfo:
+		return 6  //informational
+	case LevelWarn:
+		return 4  //warning
+	default:
+		return 3  //error
+	}
+}
+
+//printable ascii without space, "-" for empty
+func appendSyslogName(buf []byte, name string, max int) []byte {
+	if len(name) == 0 {
+		return append(buf, '-')
+	}
+	if len(name) > max {
+		name = name[:max]
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+
+//octet counting framing:
+
+//turn buf[beg:] into "LEN SP MSG"
+func prependLength(buf []byte, beg int) []byte {
+	var arr [24]byte
+	prefix := strconv.AppendInt(arr[:0], int64(len(buf) - beg), 10)
+	prefix = append(prefix, ' ')
+
+	end := len(buf)
+	buf = append(buf, prefix...)
+	copy(buf[beg + len(prefix):], buf[beg:end])
+	copy(buf[beg:], prefix)
+	return buf
+}
+
+//returns first message and the rest, nil message if malformed
+func nextFrame(data []byte) ([]byte, []byte) {
+	n := 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c == ' ' {
+			if i == 0 || len(data) - i - 1 < n {
+				return nil, nil
+			}
+			return data[i+1 : i+1+n], data[i+1+n:]
+		}
+		if c < '0' || c > '9' {
+			return nil, nil
+		}
+		n = n * 10 + int(c - '0')
+	}
+	return nil, nil
+}
+
+//number of frames in data
+func countFrames(data []byte) int {
+	n := 0
+	for len(data) != 0 {
+		msg, next := nextFrame(data)
+		if msg == nil {
+			break
+		}
+		data = next
+		n++
+	}
+	return n
+}
+
+//returns offset of the frame containing data[pos]
+func frameStart(data []byte, pos int) int {
+	off := 0
+	for off < len(data) {
+		msg, next := nextFrame(data[off:])
+		if msg == nil {
+			break
+		}
+		end := len(data) - len(next)
+		if pos < end {
+			return off
+		}
+		off = end
+	}
+	return len(data)
+}
@@ -0,0 +1,271 @@
+package purelog
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tailQueueSize = 1000              //default per-subscriber queue size
+	tailHeartbeat = 15 * time.Second  //keep-alive comment interval
+)
+
+//sink streams entries to http clients with server-sent events
+//
+//entries are fanned out on flush, each subscriber has a bounded queue, a slow
+//subscriber gets a "dropped" event instead of blocking the flush.
+//
+//query parameters: level (minimum level, e.g. warn) and q (substring filter).
+//Level is LevelOff while nobody is watching, so entries aren't built for nothing.
+type TailSink struct {
+	level     uint32
+	minLevel  uint32  //Level(): max of level and lowest subscriber level
+	nsubs     int32
+	queueSize int
+	encoder   atomic.Value
+	db        doubleBuffer
+	mtx       sync.Mutex
+	subs      map[*tailSub]struct{}
+	done      chan struct{}
+	closed    bool
+}
+
+type tailSub struct {
+	level   Level
+	filter  string
+	ch      chan string
+	dropped int64
+}
+
+//new tail sink
+//
+//default level is debug, encoder is TextEncoder and queue size is 1000 entries.
+func NewTailSink() *TailSink {
+	s := &TailSink{
+		queueSize: tailQueueSize,
+		subs:      map[*tailSub]struct{}{},
+		done:      make(chan struct{}),
+		minLevel:  uint32(LevelOff),
+	}
+	s.encoder.Store(encoderHolder{TextEncoder})
+	s.db.init()
+	return s
+}
+
+func (s *TailSink) SetLevel(level Level) *TailSink {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	atomic.StoreUint32(&s.level, uint32(level))
+	s.updateLevel()
+	return s
+}
+
+func (s *TailSink) SetEncoder(encoder Encoder) *TailSink {
+	s.encoder.Store(encoderHolder{encoder})
+	return s
+}
+
+//set per-subscriber queue size, must be called before serving
+func (s *TailSink) SetQueueSize(size int) *TailSink {
+	if size > 0 {
+		s.queueSize = size
+	}
+	return s
+}
+
+func (s *TailSink) Level() Level {
+	return Level(atomic.LoadUint32(&s.minLevel))
+}
+
+//recompute Level() from subscribers, must hold mtx
+func (s *TailSink) updateLevel() {
+	min := LevelOff
+	for sub := range s.subs {
+		if sub.level < min {
+			min = sub.level
+		}
+	}
+	if level := Level(atomic.LoadUint32(&s.level)); min < level {
+		min = level
+	}
+	atomic.StoreUint32(&s.minLevel, uint32(min))
+}
+
+func (s *TailSink) Write(e *Entry) {
+	//nobody is watching
+	if atomic.LoadInt32(&s.nsubs) == 0 {
+		return
+	}
+	s.db.write(tailEncoder{s.encoder.Load().(encoderHolder).Encoder}, e)
+}
+
+//fan out entries to subscribers, never blocks
+func (s *TailSink) Flush() error {
+	buf := s.db.swap()
+	defer s.db.recycle()
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for data := buf.Data; len(data) != 0; {
+		var msg []byte
+		msg, data = nextFrame(data)
+		if len(msg) == 0 {
+			break
+		}
+
+		level, line := Level(msg[0]), ""
+		for sub := range s.subs {
+			if level < sub.level {
+				continue
+			}
+			if len(line) == 0 {
+				line = string(bytes.TrimSuffix(msg[1:], newline))
+			}
+			if len(sub.filter) != 0 && !strings.Contains(line, sub.filter) {
+				continue
+			}
+			select {
+			case sub.ch <- line:
+			default:
+				atomic.AddInt64(&sub.dropped, 1)
+			}
+		}
+	}
+	return nil
+}
+
+//end all streams
+func (s *TailSink) Close() error {
+	err := s.Flush()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	return err
+}
+
+func (s *TailSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	level := LevelDebug
+	if name := r.URL.Query().Get("level"); len(name) != 0 {
+		if level, ok = LookupLevel(name); !ok {
+			http.Error(w, "unknown level " + strconv.Quote(name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub := &tailSub{
+		level:  level,
+		filter: r.URL.Query().Get("q"),
+		ch:     make(chan string, s.queueSize),
+	}
+	if !s.subscribe(sub) {
+		http.Error(w, "tail closed", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.unsubscribe(sub)
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+
+	var buf []byte
+	for {
+		buf = buf[:0]
+		select {
+		case line := <-sub.ch:
+			buf = appendEvent(buf, "log", line)
+		case <-heartbeat.C:
+			buf = append(buf, ": ping\n\n"...)
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+
+		//report drops once queue is drained
+		if len(sub.ch) == 0 {
+			if n := atomic.SwapInt64(&sub.dropped, 0); n != 0 {
+				buf = appendEvent(buf, "dropped", "dropped " + strconv.FormatInt(n, 10) + " entries")
+			}
+		}
+
+		if _, err := w.Write(buf); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *TailSink) subscribe(sub *tailSub) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return false
+	}
+	s.subs[sub] = struct{}{}
+	atomic.AddInt32(&s.nsubs, 1)
+	s.updateLevel()
+	return true
+}
+
+func (s *TailSink) unsubscribe(sub *tailSub) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.subs, sub)
+	atomic.AddInt32(&s.nsubs, -1)
+	s.updateLevel()
+}
+
+//event: name\ndata: line\n...\n\n
+func appendEvent(buf []byte, event, data string) []byte {
+	buf = append(buf, "event: "...)
+	buf = append(buf, event...)
+	buf = append(buf, '\n')
+	for {
+		idx := strings.IndexByte(data, '\n')
+		buf = append(buf, "data: "...)
+		if idx == -1 {
+			buf = append(buf, data...)
+			break
+		}
+		buf = append(buf, data[:idx]...)
+		buf = append(buf, '\n')
+		data = data[idx+1:]
+	}
+	return append(buf, "\n\n"...)
+}
+
+//tail encoder, emits "LEN SP LEVEL LINE"
+type tailEncoder struct {
+	Encoder
+}
+
+func (enc tailEncoder) Encode(buf []byte, e *Entry) []byte {
+	beg := len(buf)
+	buf = append(buf, byte(e.Level))
+	buf = enc.Encoder.Encode(buf, e)
+	return prependLength(buf, beg)
+}
@@ -0,0 +1,83 @@
+package purelog
+
+import (
+	"strconv"
+	"time"
+)
+
+//timestamp format of text output
+type TimeFormat uint32
+const (
+	TimeDefault      TimeFormat = iota  //1949-10-01 07:00:00.000000
+	TimeMilli                           //1949-10-01 07:00:00.000
+	TimeNano                            //1949-10-01 07:00:00.000000000
+	TimeRFC3339                         //1949-10-01T07:00:00.000000+08:00
+	TimeRFC3339Milli                    //1949-10-01T07:00:00.000+08:00
+	TimeRFC3339Nano                     //1949-10-01T07:00:00.000000000+08:00
+	TimeUnix                            //-638755200
+	TimeUnixMilli                       //-638755200000
+)
+
+//append t in format, without allocation
+func appendTime(buf []byte, t time.Time, format TimeFormat) []byte {
+	switch format {
+	case TimeMilli:
+		return appendDateTime(buf, t, ' ', 3)
+	case TimeNano:
+		return appendDateTime(buf, t, ' ', 9)
+	case TimeRFC3339:
+		return appendZone(appendDateTime(buf, t, 'T', 6), t)
+	case TimeRFC3339Milli:
+		return appendZone(appendDateTime(buf, t, 'T', 3), t)
+	case TimeRFC3339Nano:
+		return appendZone(appendDateTime(buf, t, 'T', 9), t)
+	case TimeUnix:
+		return strconv.AppendInt(buf, t.Unix(), 10)
+	case TimeUnixMilli:
+		return strconv.AppendInt(buf, t.Unix() * 1000 + int64(t.Nanosecond() / 1e6), 10)
+	default:
+		return appendTimestamp(buf, t)
+	}
+}
+
+//1949-10-01 07:00:00 with sep between date and time, then digits of fraction
+func appendDateTime(buf []byte, t time.Time, sep byte, digits int) []byte {
+	y, m, d := t.Date()
+	h, min, s := t.Clock()
+
+	buf = appendInt0(buf, y, 4)
+	buf = append(buf, '-')
+	buf = appendInt0(buf, int(m), 2)
+	buf = append(buf, '-')
+	buf = appendInt0(buf, d, 2)
+	buf = append(buf, sep)
+	buf = appendInt0(buf, h, 2)
+	buf = append(buf, ':')
+	buf = appendInt0(buf, min, 2)
+	buf = append(buf, ':')
+	buf = appendInt0(buf, s, 2)
+	buf = append(buf, '.')
+
+	frac := t.Nanosecond()
+	for i := digits; i < 9; i++ {
+		frac /= 10
+	}
+	return appendInt0(buf, frac, digits)
+}
+
+//Z or +08:00
+func appendZone(buf []byte, t time.Time) []byte {
+	_, offset := t.Zone()
+	if offset == 0 {
+		return append(buf, 'Z')
+	}
+	if offset < 0 {
+		buf = append(buf, '-')
+		offset = -offset
+	} else {
+		buf = append(buf, '+')
+	}
+	buf = appendInt0(buf, offset / 3600, 2)
+	buf = append(buf, ':')
+	return appendInt0(buf, offset / 60 % 60, 2)
+}